@@ -46,7 +46,7 @@ func AdminFilterMw(next router.RouteHandler) router.RouteHandler {
 		}
 
 		log.Printf("[AdminFilterMw] access denined")
-		return nil
+		return router.Deny(c)
 	})
 }
 
@@ -69,7 +69,7 @@ func main() {
 	r := router.NewRouter()
 
 	// --- Apply Global Middleware using r.Use() ---
-	r.Use(LoggerMw)
+	r.Use(router.Recoverer, LoggerMw)
 
 	// --- Public Routes (No specific role required) ---
 	r.HandleFuncText("/start", func(c telebot.Context) error {
@@ -102,6 +102,11 @@ func main() {
 		return c.Send("Unknown command.")
 	})
 
+	// --- Register a Forbidden Handler (called when a middleware uses router.Deny) ---
+	r.Forbidden(func(c telebot.Context) error {
+		return c.Send("Access denied.")
+	})
+
 	// --- Connect Router to Telebot ---
 	bot.Handle(telebot.OnText, r.ServeContext)
 
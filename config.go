@@ -0,0 +1,235 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/telebot.v4"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RouteConfig describes a route loaded from a configuration file by LoadRoutes.
+// Each route sets exactly one of Pattern and Regexp and exactly one of Reply
+// and Handler.
+type RouteConfig struct {
+	// Name is the optional route name (see Mux.Named).
+	Name string `json:"name" yaml:"name"`
+	// Type is either "text" (the default) or "callback".
+	Type string `json:"type" yaml:"type"`
+	// Pattern is matched exactly against the text or callback data.
+	Pattern string `json:"pattern" yaml:"pattern"`
+	// Regexp is a regular expression matched against the text or callback data.
+	Regexp string `json:"regexp" yaml:"regexp"`
+	// Reply is a canned text sent in response.
+	Reply string `json:"reply" yaml:"reply"`
+	// Handler is the name of a handler registered with RegisterHandler.
+	Handler string `json:"handler" yaml:"handler"`
+}
+
+// RoutesConfig is the content of a route configuration file.
+type RoutesConfig struct {
+	Routes []RouteConfig `json:"routes" yaml:"routes"`
+}
+
+// RegisterHandler makes h available to configuration files loaded by
+// LoadRoutes under the given name.
+func (m *Mux) RegisterHandler(name string, h RouteHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.namedHandlers == nil {
+		m.namedHandlers = make(map[string]RouteHandler)
+	}
+	m.namedHandlers[name] = h
+}
+
+// RegisterHandlerFunc is a convenience method for registering a
+// telebot.HandlerFunc with RegisterHandler.
+func (m *Mux) RegisterHandlerFunc(name string, fn telebot.HandlerFunc) {
+	m.RegisterHandler(name, HandlerFunc(fn))
+}
+
+// namedHandler returns the handler registered under name on m or one of its ancestors.
+func (m *Mux) namedHandler(name string) (RouteHandler, bool) {
+	for current := m; current != nil; current = current.parent {
+		current.mu.Lock()
+		h, ok := current.namedHandlers[name]
+		current.mu.Unlock()
+		if ok {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+// LoadRoutes reads route definitions from a JSON (.json) or YAML (.yaml, .yml)
+// file, validates them and registers them on m, replacing the routes of the
+// previous LoadRoutes call on m in one atomic swap of the route table.
+// Updates already being dispatched keep using the previous routes.
+// If the file is invalid, the current routes are left untouched.
+func (m *Mux) LoadRoutes(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("router: load routes: %w", err)
+	}
+
+	var cfg RoutesConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		return fmt.Errorf("router: load routes: unsupported file extension %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("router: load routes: %w", err)
+	}
+	return m.ApplyRoutes(cfg)
+}
+
+// ApplyRoutes validates cfg and registers its routes on m like LoadRoutes.
+func (m *Mux) ApplyRoutes(cfg RoutesConfig) error {
+	var exact []exactEntry
+	var keys []string
+	var regex []regexEntry
+	middlewares := m.collectMiddlewares()
+	responses := m.collectResponseMiddlewares()
+	current := m.root().routes()
+	seen := map[TypeHandling]map[string]int{TextHandle: {}, CallbackHandle: {}}
+
+	for i, rc := range cfg.Routes {
+		var t TypeHandling
+		switch rc.Type {
+		case "", "text":
+			t = TextHandle
+		case "callback":
+			t = CallbackHandle
+		default:
+			return fmt.Errorf("router: route %d: unknown type %q", i, rc.Type)
+		}
+
+		if (rc.Pattern == "") == (rc.Regexp == "") {
+			return fmt.Errorf("router: route %d: exactly one of pattern and regexp must be set", i)
+		}
+		if (rc.Reply == "") == (rc.Handler == "") {
+			return fmt.Errorf("router: route %d: exactly one of reply and handler must be set", i)
+		}
+
+		var h RouteHandler
+		if rc.Handler != "" {
+			named, ok := m.namedHandler(rc.Handler)
+			if !ok {
+				return fmt.Errorf("router: route %d: unknown handler %q", i, rc.Handler)
+			}
+			h = named
+		} else {
+			reply := rc.Reply
+			h = HandlerFunc(func(ctx telebot.Context) error {
+				return ctx.Send(reply)
+			})
+		}
+
+		if rc.Pattern != "" {
+			key, norm := m.exactKey(rc.Pattern, t)
+			if j, ok := seen[t][key]; ok {
+				return fmt.Errorf("router: route %d: pattern %q duplicates route %d", i, rc.Pattern, j)
+			}
+			seen[t][key] = i
+			// Only the routes loaded into m before are replaced.
+			if entry, ok := current.exact(t)[key]; ok && !(entry.fromConfig && entry.mux == m) {
+				return fmt.Errorf("router: route %d: pattern %q is already registered", i, rc.Pattern)
+			}
+			name := rc.Name
+			if name == "" {
+				name = m.routeName(rc.Pattern)
+			}
+			exact = append(exact, exactEntry{
+				handler:    chain(middlewares, h),
+				responses:  responses,
+				mux:        m,
+				info:       RouteInfo{Name: name, Pattern: rc.Pattern, Type: t, Limiter: m.routeLimiter()},
+				norm:       norm,
+				fromConfig: true,
+			})
+			keys = append(keys, key)
+			continue
+		}
+
+		re, err := regexp.Compile(rc.Regexp)
+		if err != nil {
+			return fmt.Errorf("router: route %d: %w", i, err)
+		}
+		name := rc.Name
+		if name == "" {
+			name = m.routeName(re.String())
+		}
+		var norm *normalization
+		if t == TextHandle {
+			norm = m.routeNormalization()
+		}
+		regex = append(regex, regexEntry{
+			regex:      re,
+			handler:    chain(middlewares, h),
+			responses:  responses,
+			mux:        m,
+			info:       RouteInfo{Name: name, Pattern: re.String(), Type: t, Regexp: true, Limiter: m.routeLimiter()},
+			norm:       norm,
+			fromConfig: true,
+		})
+	}
+
+	m.updateRoutes(func(rt *routeTable) {
+		rt.removeConfig(m)
+		for i, entry := range exact {
+			rt.exact(entry.info.Type)[keys[i]] = entry
+		}
+		for _, entry := range regex {
+			rt.setRegex(entry.info.Type, append(rt.regex(entry.info.Type), entry))
+		}
+	})
+	return nil
+}
+
+// WatchRoutes loads the routes from path and then polls the file every
+// interval, reloading it with LoadRoutes whenever its modification time or
+// size changes. Errors are passed to onError, if not nil; a failed reload
+// keeps the previous routes. WatchRoutes blocks until ctx is done.
+func (m *Mux) WatchRoutes(ctx context.Context, path string, interval time.Duration, onError func(error)) {
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+
+	var modTime time.Time
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		modTime, size = info.ModTime(), info.Size()
+	}
+	report(m.LoadRoutes(path))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				report(fmt.Errorf("router: watch routes: %w", err))
+				continue
+			}
+			if info.ModTime().Equal(modTime) && info.Size() == size {
+				continue
+			}
+			modTime, size = info.ModTime(), info.Size()
+			report(m.LoadRoutes(path))
+		}
+	}
+}
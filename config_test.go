@@ -0,0 +1,118 @@
+package router
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tb "gopkg.in/telebot.v4"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadRoutes(t *testing.T) {
+	t.Run("Canned Replies And Named Handlers", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "routes.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(`
+routes:
+  - pattern: hello
+    reply: Hi there!
+  - type: callback
+    regexp: "^buy:\\d+$"
+    handler: buy
+`), 0o644))
+
+		mux := NewRouter()
+		mux.RegisterHandlerFunc("buy", func(ctx tb.Context) error {
+			return ctx.Send("bought")
+		})
+		require.NoError(t, mux.LoadRoutes(path))
+
+		ctx := &mockContext{text: "hello"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"Hi there!"}, ctx.sent)
+
+		ctx = &mockContext{callback: "buy:7"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"bought"}, ctx.sent)
+	})
+
+	t.Run("Reload Replaces Previous Routes", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "routes.json")
+		mux := NewRouter()
+		mux.HandleFuncText("/start", func(ctx tb.Context) error {
+			return ctx.Send("start")
+		})
+
+		require.NoError(t, os.WriteFile(path, []byte(`{"routes": [{"pattern": "old", "reply": "old"}]}`), 0o644))
+		require.NoError(t, mux.LoadRoutes(path))
+		require.NoError(t, os.WriteFile(path, []byte(`{"routes": [{"pattern": "new", "reply": "new"}]}`), 0o644))
+		require.NoError(t, mux.LoadRoutes(path))
+
+		assert.ErrorIs(t, mux.ServeContext(&mockContext{text: "old"}), ErrNotFound)
+		ctx := &mockContext{text: "new"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"new"}, ctx.sent)
+		assert.Len(t, mux.Routes(), 2)
+	})
+
+	t.Run("Invalid Config Keeps Routes", func(t *testing.T) {
+		mux := NewRouter()
+		require.NoError(t, mux.ApplyRoutes(RoutesConfig{Routes: []RouteConfig{{Pattern: "a", Reply: "a"}}}))
+
+		err := mux.ApplyRoutes(RoutesConfig{Routes: []RouteConfig{{Pattern: "b", Handler: "missing"}}})
+		assert.EqualError(t, err, `router: route 0: unknown handler "missing"`)
+		assert.Equal(t, "a", mux.Routes()[0].Pattern)
+	})
+
+	t.Run("Duplicate Patterns", func(t *testing.T) {
+		mux := NewRouter()
+		err := mux.ApplyRoutes(RoutesConfig{Routes: []RouteConfig{{Pattern: "a", Reply: "1"}, {Pattern: "a", Reply: "2"}}})
+		assert.EqualError(t, err, `router: route 1: pattern "a" duplicates route 0`)
+
+		require.NoError(t, mux.ApplyRoutes(RoutesConfig{Routes: []RouteConfig{{Pattern: "a", Reply: "1"}}}))
+		sub := mux.With().(*Mux)
+		err = sub.ApplyRoutes(RoutesConfig{Routes: []RouteConfig{{Pattern: "a", Reply: "2"}}})
+		assert.EqualError(t, err, `router: route 0: pattern "a" is already registered`)
+	})
+}
+
+func TestWatchRoutes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"routes": [{"pattern": "old", "reply": "old"}]}`), 0o644))
+
+	mux := NewRouter()
+	errs := make(chan error, 10)
+	watchCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mux.WatchRoutes(watchCtx, path, time.Millisecond, func(err error) {
+			errs <- err
+		})
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	replies := func(text string) bool {
+		ctx := &mockContext{text: text}
+		return mux.ServeContext(ctx) == nil && len(ctx.sent) == 1 && ctx.sent[0] == text
+	}
+	assert.Eventually(t, func() bool { return replies("old") }, time.Second, time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"routes": [{"pattern": "newer", "reply": "newer"}]}`), 0o644))
+	assert.Eventually(t, func() bool { return replies("newer") }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, mux.ServeContext(&mockContext{text: "old"}), ErrNotFound)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"routes": [`), 0o644))
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("onError was not called for an invalid file")
+	}
+	assert.True(t, replies("newer"))
+}
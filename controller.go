@@ -0,0 +1,100 @@
+package router
+
+import (
+	"fmt"
+	"gopkg.in/telebot.v4"
+	"regexp"
+)
+
+// RouteDescriptor describes a route of a Controller. Exactly one of Pattern,
+// Regexp and Command must be set. Routes match text messages unless Callback
+// is set.
+type RouteDescriptor struct {
+	// Callback makes a Pattern or Regexp route match callback data instead
+	// of text messages. It must not be set for commands.
+	Callback bool
+	// Pattern is matched exactly against the text or callback data.
+	Pattern string
+	// Regexp is matched against the text or callback data.
+	Regexp *regexp.Regexp
+	// Command is a bot command such as "/start". It matches text messages
+	// consisting of the command, optionally addressed to the bot ("/start@bot")
+	// and followed by arguments.
+	Command string
+	// Name is the optional route name (see Mux.Named).
+	Name string
+	// Handler handles the route.
+	Handler telebot.HandlerFunc
+	// Middlewares are applied to this route only, after the controller's middlewares.
+	Middlewares []func(RouteHandler) RouteHandler
+}
+
+// Controller groups the routes of one feature of a bot, usually as methods
+// of a struct holding the feature's dependencies.
+type Controller interface {
+	// Routes returns the routes of the controller.
+	Routes() []RouteDescriptor
+}
+
+// ControllerMiddlewares can be implemented by a Controller to apply
+// middlewares to all of its routes.
+type ControllerMiddlewares interface {
+	// Middlewares returns the middlewares applied to every route of the controller.
+	Middlewares() []func(RouteHandler) RouteHandler
+}
+
+// RegisterController registers the routes of c in a new group of m, applying
+// the controller's middlewares if it implements ControllerMiddlewares.
+// It panics if a route descriptor is invalid.
+func (m *Mux) RegisterController(c Controller) {
+	var middlewares []func(RouteHandler) RouteHandler
+	if cm, ok := c.(ControllerMiddlewares); ok {
+		middlewares = cm.Middlewares()
+	}
+	group := m.With(middlewares...)
+
+	for i, d := range c.Routes() {
+		set := 0
+		for _, ok := range []bool{d.Pattern != "", d.Regexp != nil, d.Command != ""} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			panic(fmt.Sprintf("router: controller %T route %d: exactly one of Pattern, Regexp and Command must be set", c, i))
+		}
+		if d.Callback && d.Command != "" {
+			panic(fmt.Sprintf("router: controller %T route %d: Callback set for command %q", c, i, d.Command))
+		}
+		if d.Handler == nil {
+			panic(fmt.Sprintf("router: controller %T route %d: nil Handler", c, i))
+		}
+
+		r := group
+		if d.Name != "" {
+			r = r.Named(d.Name)
+		}
+		if len(d.Middlewares) > 0 {
+			r = r.With(d.Middlewares...)
+		}
+
+		t := TextHandle
+		if d.Callback {
+			t = CallbackHandle
+		}
+		switch {
+		case d.Pattern != "":
+			r.HandleFunc(d.Pattern, d.Handler, t)
+		case d.Regexp != nil:
+			r.HandleFuncRegexp(d.Regexp, d.Handler, t)
+		default:
+			r.HandleFuncRegexp(commandRegexp(d.Command), d.Handler, TextHandle)
+		}
+	}
+}
+
+// commandRegexp returns a regular expression matching text messages that
+// invoke the given bot command.
+func commandRegexp(command string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(command) + `(@\w+)?(\s|$)`)
+}
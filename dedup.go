@@ -0,0 +1,100 @@
+package router
+
+import (
+	"errors"
+	"gopkg.in/telebot.v4"
+	"strconv"
+	"time"
+)
+
+// errUnchanged aborts a Storage update, leaving the stored value and its
+// expiry unchanged.
+var errUnchanged = errors.New("router: unchanged")
+
+// seen records key in storage for window and reports whether it was already
+// recorded.
+func seen(storage Storage, key string, window time.Duration) (bool, error) {
+	err := storage.Update(key, window, func(value []byte) ([]byte, error) {
+		if value != nil {
+			return nil, errUnchanged
+		}
+		return []byte{1}, nil
+	})
+	if errors.Is(err, errUnchanged) {
+		return true, nil
+	}
+	return false, err
+}
+
+// DedupConfig configures the middleware returned by DedupCallbacks.
+type DedupConfig struct {
+	// Window is how long an identical callback is considered a duplicate.
+	// Defaults to 2 seconds.
+	Window time.Duration
+	// Storage keeps the recent callbacks. Defaults to a new MemoryStorage.
+	Storage Storage
+}
+
+// DedupCallbacks returns a middleware that protects against double taps on
+// inline buttons: a callback with the same data, from the same user, on the
+// same message as a callback seen within the window is answered without
+// calling the handler. Other updates pass through unchanged.
+func DedupCallbacks(cfg DedupConfig) func(RouteHandler) RouteHandler {
+	if cfg.Window <= 0 {
+		cfg.Window = 2 * time.Second
+	}
+	if cfg.Storage == nil {
+		cfg.Storage = NewMemoryStorage()
+	}
+
+	return func(next RouteHandler) RouteHandler {
+		return HandlerFunc(func(ctx telebot.Context) error {
+			cb := ctx.Callback()
+			if cb == nil {
+				return next.ServeContext(ctx)
+			}
+
+			message := cb.MessageID
+			if cb.Message != nil {
+				message = strconv.Itoa(cb.Message.ID)
+			}
+			var sender string
+			if cb.Sender != nil {
+				sender = strconv.FormatInt(cb.Sender.ID, 10)
+			}
+			key := "dedup:callback:" + cb.ChatInstance + ":" + message + ":" + sender + ":" + cb.Data
+
+			duplicate, err := seen(cfg.Storage, key, cfg.Window)
+			if err != nil {
+				return err
+			}
+			if !duplicate {
+				return next.ServeContext(ctx)
+			}
+			MarkHandled(ctx)
+			return ctx.Respond()
+		})
+	}
+}
+
+// WithUpdateDeduplication makes ServeContext drop updates whose update ID was
+// already seen within window, such as webhook retries, before routing them.
+// If window is zero or negative, it defaults to a minute. If storage is nil,
+// a new MemoryStorage is used.
+func WithUpdateDeduplication(storage Storage, window time.Duration) Option {
+	if window <= 0 {
+		window = time.Minute
+	}
+	if storage == nil {
+		storage = NewMemoryStorage()
+	}
+	return func(s *settings) {
+		s.updateDedup = func(ctx telebot.Context) (bool, error) {
+			id := ctx.Update().ID
+			if id == 0 {
+				return false, nil
+			}
+			return seen(storage, "dedup:update:"+strconv.Itoa(id), window)
+		}
+	}
+}
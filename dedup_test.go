@@ -0,0 +1,46 @@
+package router
+
+import (
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/telebot.v4"
+	"testing"
+	"time"
+)
+
+func TestDedup(t *testing.T) {
+	t.Run("Callbacks", func(t *testing.T) {
+		mux := NewRouter()
+		mux.With(DedupCallbacks(DedupConfig{})).HandleFuncCallback("buy", func(ctx tb.Context) error {
+			return ctx.Send("bought")
+		})
+
+		var sent []string
+		for i := 0; i < 2; i++ {
+			ctx := &mockContext{callback: "buy", chat: 1}
+			assert.NoError(t, mux.ServeContext(ctx))
+			sent = append(sent, ctx.sent...)
+		}
+		assert.Equal(t, []string{"bought", "respond"}, sent)
+
+		ctx := &mockContext{callback: "buy", chat: 2}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"bought"}, ctx.sent)
+	})
+
+	t.Run("Updates", func(t *testing.T) {
+		// A zero window uses the default one.
+		for _, window := range []time.Duration{time.Minute, 0} {
+			mux := NewRouter(WithUpdateDeduplication(nil, window))
+			calls := 0
+			mux.HandleFuncText("/start", func(ctx tb.Context) error {
+				calls++
+				return ctx.Send("hello")
+			})
+
+			for i := 0; i < 3; i++ {
+				assert.NoError(t, mux.ServeContext(&mockContext{text: "/start"}))
+			}
+			assert.Equal(t, 1, calls, window)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package router
+
+import (
+	"errors"
+	"gopkg.in/telebot.v4"
+	"log"
+)
+
+// ErrorHandler handles an error returned by the handler of route. The value it
+// returns is passed back to telebot.
+type ErrorHandler func(ctx telebot.Context, err error, route RouteInfo) error
+
+// UserError is an error whose message is meant to be shown to the user.
+// Error handlers created by this package deliver the message to the user
+// (as an alert for callbacks and as a reply for text messages) instead of
+// returning the error to telebot.
+type UserError struct {
+	// Message is the text shown to the user.
+	Message string
+	// Err is the optional underlying error.
+	Err error
+}
+
+// NewUserError returns a UserError with the given message.
+func NewUserError(message string) *UserError {
+	return &UserError{Message: message}
+}
+
+// Error implements the error interface.
+func (e *UserError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying error.
+func (e *UserError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultErrorHandler delivers UserError messages to the user and returns
+// every other error unchanged, so it reaches telebot's OnError.
+func DefaultErrorHandler(ctx telebot.Context, err error, route RouteInfo) error {
+	var userErr *UserError
+	if errors.As(err, &userErr) {
+		return SendUserMessage(ctx, userErr.Message)
+	}
+	return err
+}
+
+// UserFacingErrorHandler returns an ErrorHandler that delivers UserError
+// messages to the user, while every other error is logged with its route
+// and replaced with the generic message. Panics whose PanicError is already
+// Reported are only logged. If logger is nil, the standard logger is used.
+func UserFacingErrorHandler(generic string, logger *log.Logger) ErrorHandler {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(ctx telebot.Context, err error, route RouteInfo) error {
+		var userErr *UserError
+		if errors.As(err, &userErr) {
+			return SendUserMessage(ctx, userErr.Message)
+		}
+		logger.Printf("router: route %q: %v", route.Pattern, err)
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) && panicErr.Reported {
+			return nil
+		}
+		return SendUserMessage(ctx, generic)
+	}
+}
+
+// SendUserMessage shows text to the user: as an alert when the update is a
+// callback query and as a reply otherwise.
+func SendUserMessage(ctx telebot.Context, text string) error {
+	if ctx.Callback() != nil {
+		return ctx.RespondAlert(text)
+	}
+	return ctx.Reply(text)
+}
@@ -0,0 +1,207 @@
+package router
+
+import (
+	"errors"
+	"gopkg.in/telebot.v4"
+	"log"
+	"strconv"
+	"sync"
+)
+
+// ErrQueueFull is returned by ServeContext when the executor rejects an
+// update because the queue of its key is full (see OverflowReject).
+var ErrQueueFull = errors.New("router: queue full")
+
+// KeyFunc returns the key an update is grouped by, for example for ordering
+// or rate limiting. Updates with an empty key are not grouped.
+type KeyFunc func(ctx telebot.Context) string
+
+// KeyByChat groups updates by chat, falling back to the sender for updates
+// without a chat.
+func KeyByChat(ctx telebot.Context) string {
+	if chat := ctx.Chat(); chat != nil {
+		return strconv.FormatInt(chat.ID, 10)
+	}
+	return KeyBySender(ctx)
+}
+
+// KeyBySender groups updates by the user who sent them.
+func KeyBySender(ctx telebot.Context) string {
+	if sender := ctx.Sender(); sender != nil {
+		return strconv.FormatInt(sender.ID, 10)
+	}
+	return ""
+}
+
+// OverflowPolicy decides what the executor does with an update whose key
+// already has a full queue.
+type OverflowPolicy int
+
+const (
+	// OverflowReject rejects the new update; ServeContext returns ErrQueueFull.
+	OverflowReject OverflowPolicy = iota
+	// OverflowDropNewest silently drops the new update.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued update of the key to make room.
+	OverflowDropOldest
+)
+
+// ExecutorConfig configures the executor enabled by WithExecutor.
+type ExecutorConfig struct {
+	// Workers is the number of updates processed in parallel. Defaults to 16.
+	Workers int
+	// QueueSize is the maximum number of updates waiting per key. Defaults to 100.
+	QueueSize int
+	// Key groups updates that must be processed one at a time, in order.
+	// Defaults to KeyByChat. Updates with an empty key, such as those
+	// without a sender when grouping with KeyBySender, are not serialized.
+	Key KeyFunc
+	// Overflow decides what happens to updates exceeding QueueSize.
+	Overflow OverflowPolicy
+	// OnError receives the errors returned by Dispatch for updates processed
+	// by the executor, since they cannot be returned to telebot.
+	// Defaults to logging them with the standard logger.
+	OnError func(ctx telebot.Context, err error)
+}
+
+// executor processes updates with a bounded pool of workers, serializing
+// updates with the same key while processing different keys in parallel.
+type executor struct {
+	cfg ExecutorConfig
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queues  map[string]*keyQueue
+	ready   []*keyQueue
+	started bool
+	closed  bool
+	workers sync.WaitGroup
+}
+
+// keyQueue holds the pending jobs of one key. A queue is scheduled (present in
+// the ready list or being executed by a worker) at most once at a time.
+type keyQueue struct {
+	key       string
+	jobs      []job
+	scheduled bool
+}
+
+// job is a unit of work queued in the executor. discard is called instead of
+// run if the job is dropped because of an overflow.
+type job struct {
+	run     func()
+	discard func()
+}
+
+// newExecutor returns an executor for cfg with defaults applied.
+func newExecutor(cfg ExecutorConfig) *executor {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 16
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 100
+	}
+	if cfg.Key == nil {
+		cfg.Key = KeyByChat
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(ctx telebot.Context, err error) {
+			log.Printf("router: %v", err)
+		}
+	}
+	e := &executor{
+		cfg:    cfg,
+		queues: make(map[string]*keyQueue),
+	}
+	e.cond = sync.NewCond(&e.mu)
+	return e
+}
+
+// submit queues j under key, starting the workers on first use. If j is
+// dropped or rejected, its discard function is called.
+func (e *executor) submit(key string, j job) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.started {
+		e.started = true
+		e.workers.Add(e.cfg.Workers)
+		for i := 0; i < e.cfg.Workers; i++ {
+			go e.work()
+		}
+	}
+
+	q, ok := e.queues[key]
+	if !ok || key == "" {
+		q = &keyQueue{key: key}
+		if key != "" {
+			e.queues[key] = q
+		}
+	}
+
+	if len(q.jobs) >= e.cfg.QueueSize {
+		switch e.cfg.Overflow {
+		case OverflowDropNewest:
+			j.discard()
+			return nil
+		case OverflowDropOldest:
+			q.jobs[0].discard()
+			q.jobs = q.jobs[1:]
+		default:
+			j.discard()
+			return ErrQueueFull
+		}
+	}
+
+	q.jobs = append(q.jobs, j)
+	if !q.scheduled {
+		q.scheduled = true
+		e.ready = append(e.ready, q)
+		e.cond.Signal()
+	}
+	return nil
+}
+
+// close makes the workers exit once no job is ready. No job must be
+// submitted after close.
+func (e *executor) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	e.cond.Broadcast()
+}
+
+// work runs jobs until the executor is closed, taking one job at a time from
+// the queue that has been ready the longest.
+func (e *executor) work() {
+	defer e.workers.Done()
+	for {
+		e.mu.Lock()
+		for len(e.ready) == 0 && !e.closed {
+			e.cond.Wait()
+		}
+		if len(e.ready) == 0 {
+			e.mu.Unlock()
+			return
+		}
+		q := e.ready[0]
+		e.ready = e.ready[1:]
+		j := q.jobs[0]
+		q.jobs = q.jobs[1:]
+		e.mu.Unlock()
+
+		j.run()
+
+		e.mu.Lock()
+		if len(q.jobs) > 0 {
+			e.ready = append(e.ready, q)
+			e.cond.Signal()
+		} else {
+			q.scheduled = false
+			if e.queues[q.key] == q {
+				delete(e.queues, q.key)
+			}
+		}
+		e.mu.Unlock()
+	}
+}
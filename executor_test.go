@@ -0,0 +1,210 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/telebot.v4"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExecutor(t *testing.T) {
+	t.Run("Per Chat Ordering", func(t *testing.T) {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		got := make(map[int64][]string)
+
+		mux := NewRouter(WithExecutor(ExecutorConfig{Workers: 4}))
+		mux.HandleFuncRegexpText(regexp.MustCompile(`^\d+$`), func(ctx tb.Context) error {
+			defer wg.Done()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			got[ctx.Chat().ID] = append(got[ctx.Chat().ID], ctx.Message().Text)
+			mu.Unlock()
+			return nil
+		})
+
+		var want []string
+		for i := 0; i < 10; i++ {
+			want = append(want, fmt.Sprint(i))
+			for chat := int64(1); chat <= 3; chat++ {
+				wg.Add(1)
+				assert.NoError(t, mux.ServeContext(&mockContext{text: fmt.Sprint(i), chat: chat}))
+			}
+		}
+		wg.Wait()
+
+		for chat := int64(1); chat <= 3; chat++ {
+			assert.Equal(t, want, got[chat])
+		}
+	})
+
+	t.Run("Different Chats In Parallel", func(t *testing.T) {
+		second := make(chan struct{})
+		done := make(chan struct{})
+
+		mux := NewRouter(WithExecutor(ExecutorConfig{Workers: 2}))
+		mux.HandleFuncText("first", func(ctx tb.Context) error {
+			<-second
+			close(done)
+			return nil
+		})
+		mux.HandleFuncText("second", func(ctx tb.Context) error {
+			close(second)
+			return nil
+		})
+
+		assert.NoError(t, mux.ServeContext(&mockContext{text: "first", chat: 1}))
+		assert.NoError(t, mux.ServeContext(&mockContext{text: "second", chat: 2}))
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("updates of different chats were not processed in parallel")
+		}
+	})
+
+	t.Run("Overflow Policies", func(t *testing.T) {
+		tests := []struct {
+			overflow OverflowPolicy
+			err      error
+			want     []string
+		}{
+			{OverflowReject, ErrQueueFull, []string{"1", "2"}},
+			{OverflowDropNewest, nil, []string{"1", "2"}},
+			{OverflowDropOldest, nil, []string{"1", "3"}},
+		}
+		for _, tt := range tests {
+			release := make(chan struct{})
+			started := make(chan struct{}, 3)
+			var mu sync.Mutex
+			var got []string
+
+			mux := NewRouter(WithExecutor(ExecutorConfig{Workers: 1, QueueSize: 1, Overflow: tt.overflow}))
+			mux.HandleFuncRegexpText(regexp.MustCompile(`^\d$`), func(ctx tb.Context) error {
+				started <- struct{}{}
+				<-release
+				mu.Lock()
+				got = append(got, ctx.Message().Text)
+				mu.Unlock()
+				return nil
+			})
+
+			assert.NoError(t, mux.ServeContext(&mockContext{text: "1", chat: 1}))
+			<-started
+			assert.NoError(t, mux.ServeContext(&mockContext{text: "2", chat: 1}))
+			assert.Equal(t, tt.err, mux.ServeContext(&mockContext{text: "3", chat: 1}), tt.overflow)
+
+			close(release)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			assert.NoError(t, mux.Shutdown(ctx))
+			cancel()
+			assert.Equal(t, tt.want, got, tt.overflow)
+		}
+	})
+
+	t.Run("Cancel Route Bypasses Queue", func(t *testing.T) {
+		started := make(chan struct{})
+		cancelled := make(chan error, 1)
+
+		mux := NewRouter(WithExecutor(ExecutorConfig{Workers: 1}), WithNormalizer(FoldCase))
+		mux.HandleFuncText("/report", func(ctx tb.Context) error {
+			close(started)
+			<-GoContext(ctx).Done()
+			cancelled <- GoContext(ctx).Err()
+			return nil
+		})
+		mux.HandleCancel("/cancel", TextHandle, nil)
+
+		assert.NoError(t, mux.ServeContext(&mockContext{text: "/report", chat: 1}))
+		<-started
+
+		ctx := &mockContext{text: "/Cancel", chat: 1}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"Cancelled."}, ctx.sent)
+
+		select {
+		case err := <-cancelled:
+			assert.ErrorIs(t, err, context.Canceled)
+		case <-time.After(time.Second):
+			t.Fatal("in-flight handler was not cancelled")
+		}
+	})
+
+	t.Run("Shutdown Drains Queue", func(t *testing.T) {
+		release := make(chan struct{})
+		var mu sync.Mutex
+		var processed int
+
+		mux := NewRouter(
+			WithExecutor(ExecutorConfig{Workers: 1}),
+			WithShutdownMessage("restarting"),
+		)
+		mux.HandleFuncText("job", func(ctx tb.Context) error {
+			<-release
+			mu.Lock()
+			processed++
+			mu.Unlock()
+			return nil
+		})
+
+		assert.NoError(t, mux.ServeContext(&mockContext{text: "job", chat: 1}))
+		assert.NoError(t, mux.ServeContext(&mockContext{text: "job", chat: 1}))
+
+		shutdown := make(chan error)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			shutdown <- mux.Shutdown(ctx)
+		}()
+
+		assert.Eventually(t, func() bool {
+			lc := &mux.settings.lifecycle
+			lc.mu.Lock()
+			defer lc.mu.Unlock()
+			return lc.closing
+		}, time.Second, time.Millisecond)
+		ctx := &mockContext{text: "job", chat: 2}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"reply:restarting"}, ctx.sent)
+
+		close(release)
+		assert.NoError(t, <-shutdown)
+		assert.Equal(t, 2, processed)
+
+		exited := make(chan struct{})
+		go func() {
+			mux.settings.executor.workers.Wait()
+			close(exited)
+		}()
+		select {
+		case <-exited:
+		case <-time.After(time.Second):
+			t.Fatal("executor workers did not exit")
+		}
+	})
+
+	t.Run("Shutdown Deadline Cancels Handlers", func(t *testing.T) {
+		started := make(chan struct{})
+		mux := NewRouter()
+		mux.HandleFuncText("/long", func(ctx tb.Context) error {
+			close(started)
+			<-GoContext(ctx).Done()
+			return nil
+		})
+
+		done := make(chan error)
+		go func() {
+			done <- mux.ServeContext(&mockContext{text: "/long"})
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, mux.Shutdown(ctx), context.DeadlineExceeded)
+		assert.ErrorIs(t, <-done, ErrNotFound)
+	})
+}
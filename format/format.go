@@ -0,0 +1,353 @@
+// Package format builds Telegram messages from typed fragments and renders
+// them as HTML, MarkdownV2 or plain text with entities, escaping all text
+// for the chosen parse mode.
+//
+// Messages can be passed to the Send, Reply and Edit methods of the contexts
+// and bots the router passes to handlers, which render them and add the
+// matching parse mode or entities:
+//
+//	msg := format.New("Order ", format.Bold(order.ID), " for ", format.Mention(user, user.FirstName))
+//	return ctx.Send(msg)
+package format
+
+import (
+	"fmt"
+	"gopkg.in/telebot.v4"
+	"strconv"
+	"strings"
+)
+
+// Mode is the way a Message is rendered when it is sent.
+type Mode int
+
+const (
+	// HTML renders messages with telebot.ModeHTML.
+	HTML Mode = iota
+	// MarkdownV2 renders messages with telebot.ModeMarkdownV2.
+	MarkdownV2
+	// Entities renders messages as plain text with telebot.Entities.
+	Entities
+)
+
+// Fragment is a piece of formatted text.
+type Fragment struct {
+	kind     telebot.EntityType // empty for plain text
+	text     string             // plain text, code and pre only
+	url      string
+	user     *telebot.User
+	language string
+	children []Fragment
+}
+
+// fragments converts parts to fragments: Fragments are kept, other values
+// become plain text formatted with fmt.Sprint.
+func fragments(parts []interface{}) []Fragment {
+	result := make([]Fragment, 0, len(parts))
+	for _, part := range parts {
+		switch part := part.(type) {
+		case Fragment:
+			result = append(result, part)
+		case string:
+			result = append(result, Fragment{text: part})
+		default:
+			result = append(result, Fragment{text: fmt.Sprint(part)})
+		}
+	}
+	return result
+}
+
+// Text returns plain text.
+func Text(parts ...interface{}) Fragment {
+	return Fragment{children: fragments(parts)}
+}
+
+// Bold returns bold text.
+func Bold(parts ...interface{}) Fragment {
+	return Fragment{kind: telebot.EntityBold, children: fragments(parts)}
+}
+
+// Italic returns italic text.
+func Italic(parts ...interface{}) Fragment {
+	return Fragment{kind: telebot.EntityItalic, children: fragments(parts)}
+}
+
+// Underline returns underlined text.
+func Underline(parts ...interface{}) Fragment {
+	return Fragment{kind: telebot.EntityUnderline, children: fragments(parts)}
+}
+
+// Strikethrough returns strikethrough text.
+func Strikethrough(parts ...interface{}) Fragment {
+	return Fragment{kind: telebot.EntityStrikethrough, children: fragments(parts)}
+}
+
+// Spoiler returns text hidden behind a spoiler.
+func Spoiler(parts ...interface{}) Fragment {
+	return Fragment{kind: telebot.EntitySpoiler, children: fragments(parts)}
+}
+
+// Code returns inline monospace text.
+func Code(text string) Fragment {
+	return Fragment{kind: telebot.EntityCode, text: text}
+}
+
+// Pre returns a block of preformatted code in the given language, which may
+// be empty.
+func Pre(language, code string) Fragment {
+	return Fragment{kind: telebot.EntityCodeBlock, text: code, language: language}
+}
+
+// Link returns text linking to url.
+func Link(url string, parts ...interface{}) Fragment {
+	return Fragment{kind: telebot.EntityTextLink, url: url, children: fragments(parts)}
+}
+
+// Mention returns text mentioning user, which also works for users without
+// a username.
+func Mention(user *telebot.User, parts ...interface{}) Fragment {
+	return Fragment{kind: telebot.EntityTMention, user: user, children: fragments(parts)}
+}
+
+// Message is a formatted message.
+type Message struct {
+	// Mode is how the message is rendered when it is sent. Defaults to HTML.
+	Mode  Mode
+	parts []Fragment
+}
+
+// New returns a message made of parts, which are Fragments or values
+// formatted as plain text with fmt.Sprint.
+func New(parts ...interface{}) *Message {
+	return &Message{parts: fragments(parts)}
+}
+
+// Add appends parts to the message and returns it.
+func (m *Message) Add(parts ...interface{}) *Message {
+	m.parts = append(m.parts, fragments(parts)...)
+	return m
+}
+
+// As sets the mode of the message and returns it.
+func (m *Message) As(mode Mode) *Message {
+	m.Mode = mode
+	return m
+}
+
+// Render returns the text of the message and the send options selecting
+// its mode.
+func (m *Message) Render() (string, []interface{}) {
+	switch m.Mode {
+	case MarkdownV2:
+		return m.MarkdownV2(), []interface{}{telebot.ModeMarkdownV2}
+	case Entities:
+		text, entities := m.Entities()
+		return text, []interface{}{telebot.ModeDefault, entities}
+	}
+	return m.HTML(), []interface{}{telebot.ModeHTML}
+}
+
+// String returns the text of the message without formatting.
+func (m *Message) String() string {
+	text, _ := m.Entities()
+	return text
+}
+
+// HTML returns the message formatted for telebot.ModeHTML.
+func (m *Message) HTML() string {
+	var b strings.Builder
+	for _, f := range m.parts {
+		f.writeHTML(&b)
+	}
+	return b.String()
+}
+
+var htmlTags = map[telebot.EntityType]string{
+	telebot.EntityBold:          "b",
+	telebot.EntityItalic:        "i",
+	telebot.EntityUnderline:     "u",
+	telebot.EntityStrikethrough: "s",
+	telebot.EntitySpoiler:       "tg-spoiler",
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// EscapeHTML escapes s to be sent as plain text with telebot.ModeHTML.
+func EscapeHTML(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+func (f Fragment) writeHTML(b *strings.Builder) {
+	children := func() {
+		for _, child := range f.children {
+			child.writeHTML(b)
+		}
+	}
+
+	switch f.kind {
+	case "":
+		b.WriteString(htmlEscaper.Replace(f.text))
+		children()
+	case telebot.EntityCode:
+		b.WriteString("<code>" + htmlEscaper.Replace(f.text) + "</code>")
+	case telebot.EntityCodeBlock:
+		if f.language == "" {
+			b.WriteString("<pre>" + htmlEscaper.Replace(f.text) + "</pre>")
+		} else {
+			b.WriteString(`<pre><code class="language-` + htmlEscaper.Replace(f.language) + `">` +
+				htmlEscaper.Replace(f.text) + "</code></pre>")
+		}
+	case telebot.EntityTextLink, telebot.EntityTMention:
+		b.WriteString(`<a href="` + htmlEscaper.Replace(f.href()) + `">`)
+		children()
+		b.WriteString("</a>")
+	default:
+		tag := htmlTags[f.kind]
+		b.WriteString("<" + tag + ">")
+		children()
+		b.WriteString("</" + tag + ">")
+	}
+}
+
+// href returns the URL of a link or mention.
+func (f Fragment) href() string {
+	if f.kind == telebot.EntityTMention {
+		var id int64
+		if f.user != nil {
+			id = f.user.ID
+		}
+		return "tg://user?id=" + strconv.FormatInt(id, 10)
+	}
+	return f.url
+}
+
+// MarkdownV2 returns the message formatted for telebot.ModeMarkdownV2.
+func (m *Message) MarkdownV2() string {
+	var b strings.Builder
+	for _, f := range m.parts {
+		f.writeMarkdownV2(&b)
+	}
+	return b.String()
+}
+
+var markdownV2Markers = map[telebot.EntityType]string{
+	telebot.EntityBold:          "*",
+	telebot.EntityItalic:        "_",
+	telebot.EntityUnderline:     "__",
+	telebot.EntityStrikethrough: "~",
+	telebot.EntitySpoiler:       "||",
+}
+
+var (
+	markdownV2Escaper = newEscaper("\\_*[]()~`>#+-=|{}.!")
+	codeEscaper       = newEscaper("\\`")
+	urlEscaper        = newEscaper("\\)")
+)
+
+// EscapeMarkdownV2 escapes s to be sent as plain text with
+// telebot.ModeMarkdownV2.
+func EscapeMarkdownV2(s string) string {
+	return markdownV2Escaper.Replace(s)
+}
+
+// newEscaper returns a replacer prefixing every character of chars with a
+// backslash.
+func newEscaper(chars string) *strings.Replacer {
+	var pairs []string
+	for _, c := range chars {
+		pairs = append(pairs, string(c), "\\"+string(c))
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+func (f Fragment) writeMarkdownV2(b *strings.Builder) {
+	children := func() {
+		for _, child := range f.children {
+			child.writeMarkdownV2(b)
+		}
+	}
+
+	switch f.kind {
+	case "":
+		b.WriteString(markdownV2Escaper.Replace(f.text))
+		children()
+	case telebot.EntityCode:
+		b.WriteString("`" + codeEscaper.Replace(f.text) + "`")
+	case telebot.EntityCodeBlock:
+		b.WriteString("```" + f.language + "\n" + codeEscaper.Replace(f.text) + "\n```")
+	case telebot.EntityTextLink, telebot.EntityTMention:
+		b.WriteString("[")
+		children()
+		b.WriteString("](" + urlEscaper.Replace(f.href()) + ")")
+	default:
+		marker := markdownV2Markers[f.kind]
+		b.WriteString(marker)
+		children()
+		// Telegram reads "___" as the end of the underline first, so italic
+		// text ending with the underline is closed by a \r, which it ignores.
+		if f.kind == telebot.EntityUnderline && f.endsWithItalic() {
+			b.WriteString("\r")
+		}
+		b.WriteString(marker)
+	}
+}
+
+// endsWithItalic reports whether the text of f ends with italic text.
+func (f Fragment) endsWithItalic() bool {
+	if len(f.children) == 0 {
+		return false
+	}
+	last := f.children[len(f.children)-1]
+	return last.kind == telebot.EntityItalic || last.kind == "" && last.endsWithItalic()
+}
+
+// Entities returns the text of the message and its formatting as entities,
+// to be sent without a parse mode.
+func (m *Message) Entities() (string, telebot.Entities) {
+	var b strings.Builder
+	var entities telebot.Entities
+	offset := 0
+	for _, f := range m.parts {
+		f.writeEntities(&b, &entities, &offset)
+	}
+	return b.String(), entities
+}
+
+func (f Fragment) writeEntities(b *strings.Builder, entities *telebot.Entities, offset *int) {
+	start := *offset
+	index := len(*entities)
+	if f.kind != "" {
+		*entities = append(*entities, telebot.MessageEntity{
+			Type:     f.kind,
+			Offset:   start,
+			URL:      f.url,
+			User:     f.user,
+			Language: f.language,
+		})
+	}
+
+	b.WriteString(f.text)
+	*offset += UTF16Len(f.text)
+	for _, child := range f.children {
+		child.writeEntities(b, entities, offset)
+	}
+
+	if f.kind != "" {
+		(*entities)[index].Length = *offset - start
+		if (*entities)[index].Length == 0 {
+			*entities = append((*entities)[:index], (*entities)[index+1:]...)
+		}
+	}
+}
+
+// UTF16Len returns the length of s in UTF-16 code units, the unit Telegram
+// measures entity offsets and message lengths in.
+func UTF16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r >= 0x10000 {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,48 @@
+package format
+
+import (
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/telebot.v4"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	user := &tb.User{ID: 42}
+	msg := New("Hi ", Mention(user, "<Ann>"), "! ", Bold("1.5 * ", Italic("x")), " ", Code("a`b"), Link("https://e.com/(1)", "link"))
+
+	t.Run("HTML", func(t *testing.T) {
+		assert.Equal(t, `Hi <a href="tg://user?id=42">&lt;Ann&gt;</a>! <b>1.5 * <i>x</i></b> <code>a`+"`"+`b</code><a href="https://e.com/(1)">link</a>`, msg.HTML())
+	})
+
+	t.Run("MarkdownV2", func(t *testing.T) {
+		assert.Equal(t, "Hi [<Ann\\>](tg://user?id=42)\\! *1\\.5 \\* _x_* `a\\`b`[link](https://e.com/(1\\))", msg.MarkdownV2())
+		assert.Equal(t, "___x_\r__ __y _z_\r__", New(Underline(Italic("x")), " ", Underline("y ", Text(Italic("z")))).MarkdownV2())
+	})
+
+	t.Run("Entities", func(t *testing.T) {
+		text, entities := msg.Entities()
+		assert.Equal(t, "Hi <Ann>! 1.5 * x a`blink", text)
+		assert.Equal(t, tb.Entities{
+			{Type: tb.EntityTMention, Offset: 3, Length: 5, User: user},
+			{Type: tb.EntityBold, Offset: 10, Length: 7},
+			{Type: tb.EntityItalic, Offset: 16, Length: 1},
+			{Type: tb.EntityCode, Offset: 18, Length: 3},
+			{Type: tb.EntityTextLink, Offset: 21, Length: 4, URL: "https://e.com/(1)"},
+		}, entities)
+	})
+
+	t.Run("Escape", func(t *testing.T) {
+		assert.Equal(t, "a &lt;b&gt; &amp; c", EscapeHTML("a <b> & c"))
+		assert.Equal(t, "snake\\_case \\*1\\.5\\*", EscapeMarkdownV2("snake_case *1.5*"))
+	})
+
+	t.Run("Render", func(t *testing.T) {
+		text, opts := New(Pre("go", "x < 1")).As(MarkdownV2).Render()
+		assert.Equal(t, "```go\nx < 1\n```", text)
+		assert.Equal(t, []interface{}{tb.ModeMarkdownV2}, opts)
+
+		text, opts = New("Hello, ", Bold("<world>")).Render()
+		assert.Equal(t, "Hello, <b>&lt;world&gt;</b>", text)
+		assert.Equal(t, []interface{}{tb.ModeHTML}, opts)
+	})
+}
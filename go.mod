@@ -2,4 +2,9 @@ module github.com/LZTD1/telebot-context-router
 
 go 1.16
 
-require gopkg.in/telebot.v4 v4.0.0-beta.4
+require (
+	github.com/stretchr/testify v1.8.0
+	golang.org/x/text v0.3.7
+	gopkg.in/telebot.v4 v4.0.0-beta.4
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,145 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/telebot.v4"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Catalog holds the translations of message keys per locale:
+//
+//	router.Catalog{
+//		"en": {"btn.settings": "Settings"},
+//		"ru": {"btn.settings": "Настройки"},
+//	}
+type Catalog map[string]map[string]string
+
+// LoadCatalog reads a Catalog from a JSON (.json) or YAML (.yaml, .yml) file
+// mapping locales to keys to translations.
+func LoadCatalog(path string) (Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("router: load catalog: %w", err)
+	}
+
+	var c Catalog
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &c)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &c)
+	default:
+		return nil, fmt.Errorf("router: load catalog: unsupported file extension %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("router: load catalog: %w", err)
+	}
+	return c, nil
+}
+
+// WithCatalog sets the translations used by HandleTextKey, T and
+// ReplyKeyboard.
+func WithCatalog(c Catalog) Option {
+	return func(s *settings) {
+		s.catalog = c
+	}
+}
+
+// labels returns the distinct translations of key in every locale, sorted.
+func (c Catalog) labels(key string) []string {
+	seen := make(map[string]bool)
+	var labels []string
+	for _, messages := range c {
+		if label, ok := messages[key]; ok && !seen[label] {
+			seen[label] = true
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// translate returns the translation of key in the first of locales having
+// one.
+func (c Catalog) translate(locales []string, key string) (string, bool) {
+	for _, locale := range locales {
+		messages, ok := c[locale]
+		if !ok {
+			messages = c[strings.ToLower(locale)]
+		}
+		if label, ok := messages[key]; ok {
+			return label, true
+		}
+	}
+	return "", false
+}
+
+// T returns the translation of key for the locale of ctx (see Locale),
+// falling back like Render, or key itself if there is none.
+func T(ctx telebot.Context, key string) string {
+	if st := stateOf(ctx); st != nil && st.settings != nil {
+		if label, ok := st.settings.catalog.translate(localeChain(ctx), key); ok {
+			return label
+		}
+	}
+	return key
+}
+
+// ReplyKeyboard returns a resized reply keyboard whose buttons are labelled
+// with the translations of the given keys for the locale of ctx. Routes
+// registered with HandleTextKey for the same keys match its buttons in every
+// locale.
+func ReplyKeyboard(ctx telebot.Context, rows ...[]string) *telebot.ReplyMarkup {
+	markup := &telebot.ReplyMarkup{ResizeKeyboard: true}
+	for _, keys := range rows {
+		row := make([]telebot.ReplyButton, len(keys))
+		for i, key := range keys {
+			row[i] = telebot.ReplyButton{Text: T(ctx, key)}
+		}
+		markup.ReplyKeyboard = append(markup.ReplyKeyboard, row)
+	}
+	return markup
+}
+
+// HandleTextKey registers a handler for text messages equal to the
+// translation of key in any locale of the catalog (see WithCatalog), such as
+// the labels of reply keyboard buttons. The routes are named after key, so
+// they can be disabled together. Translations added to the catalog later are
+// not matched.
+func (m *Mux) HandleTextKey(key string, h RouteHandler) {
+	labels := m.settings.catalog.labels(key)
+	if len(labels) == 0 {
+		panic(fmt.Sprintf("router: HandleTextKey called with key %q missing from the catalog", key))
+	}
+
+	handler := chain(m.collectMiddlewares(), h)
+	responses := m.collectResponseMiddlewares()
+	name := m.routeName(key)
+	for _, label := range labels {
+		k, norm := m.exactKey(label, TextHandle)
+		m.checkExactKey(k, TextHandle, label, norm)
+	}
+	m.updateRoutes(func(rt *routeTable) {
+		for _, label := range labels {
+			key, norm := m.exactKey(label, TextHandle)
+			rt.exact(TextHandle)[key] = exactEntry{
+				handler:   handler,
+				responses: responses,
+				mux:       m,
+				info:      RouteInfo{Name: name, Pattern: label, Type: TextHandle, Limiter: m.routeLimiter()},
+				norm:      norm,
+			}
+		}
+	})
+}
+
+// HandleFuncTextKey is a convenience method for HandleTextKey with a
+// telebot.HandlerFunc.
+func (m *Mux) HandleFuncTextKey(key string, fn telebot.HandlerFunc) {
+	m.HandleTextKey(key, HandlerFunc(fn))
+}
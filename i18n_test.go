@@ -0,0 +1,71 @@
+package router
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tb "gopkg.in/telebot.v4"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandleTextKey(t *testing.T) {
+	mux := NewRouter(WithCatalog(Catalog{
+		"en": {"btn.settings": "Settings", "btn.help": "Help"},
+		"ru": {"btn.settings": "Настройки", "btn.help": "Помощь"},
+	}))
+	mux.HandleFuncTextKey("btn.settings", func(ctx tb.Context) error {
+		return ctx.Send(T(ctx, "btn.settings"), ReplyKeyboard(ctx, []string{"btn.settings", "btn.help"}))
+	})
+
+	for _, tt := range []struct{ language, text string }{{"en", "Settings"}, {"ru", "Настройки"}, {"", "Настройки"}} {
+		ctx := &mockContext{text: tt.text, chat: 1, language: tt.language}
+		assert.NoError(t, mux.ServeContext(ctx))
+		want := "Settings"
+		if tt.language == "ru" {
+			want = "Настройки"
+		}
+		assert.Equal(t, []string{want}, ctx.sent)
+	}
+
+	ctx := &mockContext{text: "Настройки", chat: 1, language: "ru"}
+	assert.NoError(t, mux.ServeContext(ctx))
+	assert.Equal(t, []interface{}{&tb.ReplyMarkup{
+		ResizeKeyboard: true,
+		ReplyKeyboard:  [][]tb.ReplyButton{{{Text: "Настройки"}, {Text: "Помощь"}}},
+	}}, ctx.opts)
+
+	mux.Disable("btn.settings")
+	ctx = &mockContext{text: "Settings", chat: 1}
+	assert.ErrorIs(t, mux.ServeContext(ctx), ErrNotFound)
+	assert.Empty(t, ctx.sent)
+}
+
+func TestLoadCatalog(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("JSON", func(t *testing.T) {
+		path := filepath.Join(dir, "catalog.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{
+			"en": {"btn.settings": "Settings"},
+			"ru": {"btn.settings": "Настройки"}
+		}`), 0o644))
+
+		c, err := LoadCatalog(path)
+		require.NoError(t, err)
+		assert.Equal(t, Catalog{
+			"en": {"btn.settings": "Settings"},
+			"ru": {"btn.settings": "Настройки"},
+		}, c)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := LoadCatalog(filepath.Join(dir, "missing.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		path := filepath.Join(dir, "malformed.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"en": [`), 0o644))
+		_, err = LoadCatalog(path)
+		assert.Error(t, err)
+	})
+}
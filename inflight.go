@@ -0,0 +1,179 @@
+package router
+
+import (
+	"context"
+	"gopkg.in/telebot.v4"
+	"sync"
+)
+
+// inflight tracks the updates being dispatched by a router hierarchy, so
+// they can be cancelled per chat.
+type inflight struct {
+	mu     sync.Mutex
+	byChat map[int64]map[*state]context.CancelFunc
+}
+
+func newInflight() *inflight {
+	return &inflight{
+		byChat: make(map[int64]map[*state]context.CancelFunc),
+	}
+}
+
+// add starts tracking the update with state s in the given chat.
+func (f *inflight) add(chatID int64, s *state, cancel context.CancelFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	updates, ok := f.byChat[chatID]
+	if !ok {
+		updates = make(map[*state]context.CancelFunc)
+		f.byChat[chatID] = updates
+	}
+	updates[s] = cancel
+}
+
+// done stops tracking the update with state s.
+func (f *inflight) done(chatID int64, s *state) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.byChat[chatID], s)
+	if len(f.byChat[chatID]) == 0 {
+		delete(f.byChat, chatID)
+	}
+}
+
+// cancelChat cancels the contexts of the updates in the given chat, except
+// the update with state except, and returns how many were cancelled.
+func (f *inflight) cancelChat(chatID int64, except *state) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for s, cancel := range f.byChat[chatID] {
+		if s == except {
+			continue
+		}
+		cancel()
+		n++
+	}
+	return n
+}
+
+// chatID returns the ID of the chat of ctx, falling back to the sender.
+func chatID(ctx telebot.Context) int64 {
+	if chat := ctx.Chat(); chat != nil {
+		return chat.ID
+	}
+	if sender := ctx.Sender(); sender != nil {
+		return sender.ID
+	}
+	return 0
+}
+
+// CancelChat cancels the contexts (see GoContext) of all handlers currently
+// processing updates of the given chat and returns how many were cancelled.
+// Handlers observe the cancellation through GoContext(ctx).Done().
+func (m *Mux) CancelChat(chatID int64) int {
+	return m.settings.inflight.cancelChat(chatID, nil)
+}
+
+// HandleCancel registers an exact route that cancels the other handlers
+// processing updates of the same chat, like CancelChat, and then calls reply
+// with the number of cancelled handlers to notify the user. If reply is nil,
+// a short confirmation is sent. Cancel routes bypass the executor (see
+// WithExecutor), so they run even while the chat's queue is busy.
+func (m *Mux) HandleCancel(pattern string, t TypeHandling, reply func(ctx telebot.Context, cancelled int) error) {
+	if reply == nil {
+		reply = func(ctx telebot.Context, cancelled int) error {
+			text := "Cancelled."
+			if cancelled == 0 {
+				text = "Nothing to cancel."
+			}
+			if ctx.Callback() != nil {
+				return ctx.RespondText(text)
+			}
+			return ctx.Send(text)
+		}
+	}
+
+	key, norm := m.exactKey(pattern, t)
+	m.settings.addCancelRoute(key, norm, t)
+	m.HandleFunc(pattern, func(ctx telebot.Context) error {
+		n := m.settings.inflight.cancelChat(chatID(ctx), stateOf(ctx))
+		return reply(ctx, n)
+	}, t)
+}
+
+// isCancelRoute reports whether input of type t matches a cancel route,
+// normalized like the route table.
+func (m *Mux) isCancelRoute(input string, t TypeHandling) bool {
+	m.settings.cancelMu.Lock()
+	defer m.settings.cancelMu.Unlock()
+	_, ok := m.lookupExact(m.settings.cancelRoutes[t], input, t)
+	return ok
+}
+
+// lifecycle counts the updates accepted by a router hierarchy, including
+// those still queued in the executor, and lets Shutdown wait for them.
+type lifecycle struct {
+	mu      sync.Mutex
+	closing bool
+	active  int
+	drained chan struct{}
+}
+
+// acquire accepts an update and reports false if the router is shutting down.
+func (l *lifecycle) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return false
+	}
+	l.active++
+	return true
+}
+
+// release marks an accepted update as finished.
+func (l *lifecycle) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	if l.active == 0 && l.closing {
+		close(l.drained)
+	}
+}
+
+// close stops accepting updates and returns a channel that is closed once
+// every accepted update has finished.
+func (l *lifecycle) close() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closing {
+		l.closing = true
+		l.drained = make(chan struct{})
+		if l.active == 0 {
+			close(l.drained)
+		}
+	}
+	return l.drained
+}
+
+// Shutdown stops the router from accepting new updates and waits until the
+// updates already accepted by ServeContext, including those queued in the
+// executor, have been processed. New updates are answered with the message
+// configured by WithShutdownMessage, if any, or rejected with
+// ErrShuttingDown. If ctx is done before the router has drained, Shutdown
+// cancels the contexts of the remaining handlers (see GoContext) and returns
+// ctx's error. The workers of the executor exit once they are done.
+func (m *Mux) Shutdown(ctx context.Context) error {
+	drained := m.settings.lifecycle.close()
+	defer m.settings.cancelBase()
+	if e := m.settings.executor; e != nil {
+		defer e.close()
+	}
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
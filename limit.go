@@ -0,0 +1,179 @@
+package router
+
+import (
+	"errors"
+	"gopkg.in/telebot.v4"
+	"sync"
+)
+
+// ErrLimitExceeded is returned by the handlers of a limited route when an
+// update is rejected because the concurrency limit is reached and the queue
+// is full (see Mux.Limit).
+var ErrLimitExceeded = errors.New("router: concurrency limit exceeded")
+
+// LimitConfig configures the concurrency limits of the routes registered on
+// a sub-router created by Mux.Limit.
+type LimitConfig struct {
+	// Global is the maximum number of concurrent executions. Zero means no limit.
+	Global int
+	// PerUser is the maximum number of concurrent executions per user.
+	// Zero means no limit.
+	PerUser int
+	// Key identifies the user. Defaults to KeyBySender.
+	Key KeyFunc
+	// MaxQueue is the maximum number of executions waiting for a free slot.
+	// Excess executions are rejected. Zero rejects them immediately.
+	MaxQueue int
+	// OnReject handles rejected updates. Defaults to returning ErrLimitExceeded.
+	OnReject telebot.HandlerFunc
+}
+
+// LimitStats is a snapshot of the state of a Limiter.
+type LimitStats struct {
+	// Running is the number of executions in progress.
+	Running int
+	// Queued is the number of executions waiting for a free slot.
+	Queued int
+}
+
+// Limiter enforces the concurrency limits of a group of routes.
+type Limiter struct {
+	cfg LimitConfig
+
+	mu      sync.Mutex
+	running int
+	perUser map[string]int
+	queued  int
+	changed chan struct{}
+}
+
+// newLimiter returns a Limiter for cfg with defaults applied.
+func newLimiter(cfg LimitConfig) *Limiter {
+	if cfg.Key == nil {
+		cfg.Key = KeyBySender
+	}
+	if cfg.OnReject == nil {
+		cfg.OnReject = func(ctx telebot.Context) error {
+			return ErrLimitExceeded
+		}
+	}
+	return &Limiter{
+		cfg:     cfg,
+		perUser: make(map[string]int),
+		changed: make(chan struct{}),
+	}
+}
+
+// Stats returns the current number of running and queued executions.
+func (l *Limiter) Stats() LimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimitStats{Running: l.running, Queued: l.queued}
+}
+
+// available reports whether a slot is free for key. l.mu must be held.
+func (l *Limiter) available(key string) bool {
+	if l.cfg.Global > 0 && l.running >= l.cfg.Global {
+		return false
+	}
+	if l.cfg.PerUser > 0 && key != "" && l.perUser[key] >= l.cfg.PerUser {
+		return false
+	}
+	return true
+}
+
+// take occupies a slot for key. l.mu must be held.
+func (l *Limiter) take(key string) {
+	l.running++
+	if key != "" {
+		l.perUser[key]++
+	}
+}
+
+// acquire waits for a free slot for key. It reports false if the update has
+// to be rejected because the queue is full or the update was cancelled.
+func (l *Limiter) acquire(ctx telebot.Context, key string) bool {
+	l.mu.Lock()
+	if l.available(key) {
+		l.take(key)
+		l.mu.Unlock()
+		return true
+	}
+	if l.queued >= l.cfg.MaxQueue {
+		l.mu.Unlock()
+		return false
+	}
+	l.queued++
+	defer func() {
+		l.mu.Lock()
+		l.queued--
+		l.mu.Unlock()
+	}()
+
+	done := GoContext(ctx).Done()
+	for {
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-done:
+			return false
+		}
+
+		l.mu.Lock()
+		if l.available(key) {
+			l.take(key)
+			l.mu.Unlock()
+			return true
+		}
+	}
+}
+
+// release frees the slot occupied for key and wakes up waiting executions.
+func (l *Limiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	if key != "" {
+		l.perUser[key]--
+		if l.perUser[key] == 0 {
+			delete(l.perUser, key)
+		}
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// middleware enforces the limits on the handlers it wraps.
+func (l *Limiter) middleware(next RouteHandler) RouteHandler {
+	return HandlerFunc(func(ctx telebot.Context) error {
+		key := l.cfg.Key(ctx)
+		if !l.acquire(ctx, key) {
+			return l.cfg.OnReject(ctx)
+		}
+		defer l.release(key)
+		return next.ServeContext(ctx)
+	})
+}
+
+// Limit creates a new Mux sub-router similar to With whose routes share the
+// concurrency limits configured by cfg: at most cfg.Global executions at a
+// time and cfg.PerUser per user, with up to cfg.MaxQueue executions waiting.
+// The Limiter is reported in the RouteInfo of the routes (see Mux.Routes).
+func (m *Mux) Limit(cfg LimitConfig) Router {
+	l := newLimiter(cfg)
+	nm := m.newChild(nil, []func(RouteHandler) RouteHandler{l.middleware})
+	nm.limiter = l
+	return nm
+}
+
+// routeLimiter returns the Limiter of the nearest limited Mux in the hierarchy.
+func (m *Mux) routeLimiter() *Limiter {
+	for current := m; current != nil; current = current.parent {
+		if current.limiter != nil {
+			return current.limiter
+		}
+	}
+	return nil
+}
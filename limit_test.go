@@ -0,0 +1,37 @@
+package router
+
+import (
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/telebot.v4"
+	"testing"
+	"time"
+)
+
+func TestLimit(t *testing.T) {
+	t.Run("Concurrency Limit", func(t *testing.T) {
+		release := make(chan struct{})
+		mux := NewRouter()
+		mux.Limit(LimitConfig{Global: 1, MaxQueue: 1}).HandleFuncText("/pdf", func(ctx tb.Context) error {
+			<-release
+			return ctx.Send("pdf")
+		})
+		limiter := mux.Routes()[0].Limiter
+
+		errs := make(chan error, 2)
+		for i := int64(1); i <= 2; i++ {
+			go func(chat int64) {
+				errs <- mux.ServeContext(&mockContext{text: "/pdf", chat: chat})
+			}(i)
+		}
+		assert.Eventually(t, func() bool {
+			return limiter.Stats() == LimitStats{Running: 1, Queued: 1}
+		}, time.Second, time.Millisecond)
+
+		assert.ErrorIs(t, mux.ServeContext(&mockContext{text: "/pdf", chat: 3}), ErrLimitExceeded)
+
+		close(release)
+		assert.NoError(t, <-errs)
+		assert.NoError(t, <-errs)
+		assert.Equal(t, LimitStats{}, limiter.Stats())
+	})
+}
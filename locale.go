@@ -0,0 +1,76 @@
+package router
+
+import (
+	"gopkg.in/telebot.v4"
+	"strings"
+	"time"
+)
+
+// localeTTL is how long a locale stored with SetLocale is kept.
+const localeTTL = 365 * 24 * time.Hour
+
+// WithLocales sets the locale used when no better one is known (defaults to
+// "en") and the storage keeping the locales chosen by users with SetLocale
+// (defaults to a new MemoryStorage).
+func WithLocales(defaultLocale string, storage Storage) Option {
+	return func(s *settings) {
+		if defaultLocale != "" {
+			s.defaultLocale = defaultLocale
+		}
+		if storage != nil {
+			s.localeStorage = storage
+		}
+	}
+}
+
+// Locale returns the locale of the user who sent the update ctx belongs to:
+// the locale stored with SetLocale if any, otherwise the language of the
+// user's Telegram client, otherwise the default locale (see WithLocales).
+func Locale(ctx telebot.Context) string {
+	defaultLocale := "en"
+	if st := stateOf(ctx); st != nil && st.settings != nil {
+		if key := KeyBySender(ctx); key != "" {
+			value, err := st.settings.localeStorage.Get("locale:" + key)
+			if err == nil && value != nil {
+				return string(value)
+			}
+		}
+		defaultLocale = st.settings.defaultLocale
+	}
+	if sender := ctx.Sender(); sender != nil && sender.LanguageCode != "" {
+		return sender.LanguageCode
+	}
+	return defaultLocale
+}
+
+// SetLocale stores the locale chosen by the user who sent the update ctx
+// belongs to, for a year. An empty locale removes the stored one.
+func SetLocale(ctx telebot.Context, locale string) error {
+	st := stateOf(ctx)
+	key := KeyBySender(ctx)
+	if st == nil || st.settings == nil || key == "" {
+		return nil
+	}
+	if locale == "" {
+		return st.settings.localeStorage.Delete("locale:" + key)
+	}
+	return st.settings.localeStorage.Update("locale:"+key, localeTTL, func([]byte) ([]byte, error) {
+		return []byte(locale), nil
+	})
+}
+
+// localeChain returns the locales to try for ctx in order: its locale, the
+// language of a regional locale (for example "pt" for "pt-br") and the
+// default locale.
+func localeChain(ctx telebot.Context) []string {
+	locale := Locale(ctx)
+	chain := []string{locale}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		chain = append(chain, locale[:i])
+	}
+	defaultLocale := "en"
+	if st := stateOf(ctx); st != nil && st.settings != nil {
+		defaultLocale = st.settings.defaultLocale
+	}
+	return append(chain, defaultLocale)
+}
@@ -1,21 +1,54 @@
 package router
 
 import (
+	"context"
 	"errors"
 	"gopkg.in/telebot.v4"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
 	// ErrNotFound is returned when no matching route is found.
 	ErrNotFound = errors.New("router: not found")
+	// ErrForbidden is returned by middlewares and handlers to signal that
+	// access to the matched route was denied. The router then calls the
+	// Forbidden handler instead of NotFound.
+	ErrForbidden = errors.New("router: forbidden")
+	// ErrSkip is returned by handlers to pass the update on to the next
+	// candidate route (the regular expression routes registered after it).
+	// A skipped handler never counts as having handled the update.
+	ErrSkip = errors.New("router: skip")
+	// ErrShuttingDown is returned by ServeContext for updates received after
+	// Shutdown has been called.
+	ErrShuttingDown = errors.New("router: shutting down")
 )
 
 // regexEntry holds a compiled regular expression and its associated handler.
 // Used for routing based on regex patterns.
 type regexEntry struct {
-	regex   *regexp.Regexp
-	handler RouteHandler
+	regex      *regexp.Regexp
+	handler    RouteHandler
+	responses  []func(ResponseHandler) ResponseHandler
+	mux        *Mux
+	info       RouteInfo
+	norm       *normalization
+	fromConfig bool
+}
+
+// exactEntry holds the handler registered for an exact pattern together with
+// the Mux it was registered on.
+type exactEntry struct {
+	handler    RouteHandler
+	responses  []func(ResponseHandler) ResponseHandler
+	mux        *Mux
+	info       RouteInfo
+	norm       *normalization
+	fromConfig bool
 }
 
 // Mux implements the Router interface. It matches incoming telebot updates
@@ -23,25 +56,72 @@ type regexEntry struct {
 // It supports exact string matching (using maps for O(1) lookup) and
 // regular expression matching (using slices for O(N) lookup).
 // Middleware can be applied globally or scoped using groups.
+// Routes can be registered, removed, disabled and enabled while updates are
+// being served concurrently.
 type Mux struct {
+	settings            *settings
 	parent              *Mux
+	scope               func(input string) bool
+	name                string
+	limiter             *Limiter
+	normalization       *normalization
 	middlewares         []func(RouteHandler) RouteHandler
-	exactTextRoutes     map[string]RouteHandler
-	exactCallbackRoutes map[string]RouteHandler
-	regexTextRoutes     []regexEntry
-	regexCallbackRoutes []regexEntry
+	responseMiddlewares []func(ResponseHandler) ResponseHandler
 	notFoundHandler     telebot.HandlerFunc
+	forbiddenHandler    telebot.HandlerFunc
+	unsupportedHandler  telebot.HandlerFunc
+	errorHandler        ErrorHandler
+
+	mu            sync.Mutex
+	children      []*Mux
+	namedHandlers map[string]RouteHandler
+	table         atomic.Value // *routeTable
 }
 
 // NewRouter returns a new, initialized Mux ready to configure.
-// It initializes internal maps and slices to avoid nil pointers.
-func NewRouter() *Mux {
-	return &Mux{
-		exactTextRoutes:     make(map[string]RouteHandler),
-		exactCallbackRoutes: make(map[string]RouteHandler),
-		regexTextRoutes:     make([]regexEntry, 0),
-		regexCallbackRoutes: make([]regexEntry, 0),
+// It initializes an empty route table and applies the given options, which
+// are shared with every sub-router.
+func NewRouter(opts ...Option) *Mux {
+	m := &Mux{
+		settings: newSettings(opts),
 	}
+	m.table.Store(newRouteTable())
+	return m
+}
+
+// routes returns the current snapshot of the Mux's route table.
+func (m *Mux) routes() *routeTable {
+	return m.table.Load().(*routeTable)
+}
+
+// updateRoutes applies fn to a copy of the route table of m and of every
+// ancestor of m and atomically replaces each table with its modified copy.
+func (m *Mux) updateRoutes(fn func(t *routeTable)) {
+	for current := m; current != nil; current = current.parent {
+		current.mu.Lock()
+		t := current.routes().clone()
+		fn(t)
+		current.table.Store(t)
+		current.mu.Unlock()
+	}
+}
+
+// childList returns a snapshot of the sub-routers of m.
+func (m *Mux) childList() []*Mux {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Mux(nil), m.children...)
+}
+
+// routeName returns the name given to routes registered on m by Named,
+// or pattern if no name was given.
+func (m *Mux) routeName(pattern string) string {
+	for current := m; current != nil; current = current.parent {
+		if current.name != "" {
+			return current.name
+		}
+	}
+	return pattern
 }
 
 // collectMiddlewares walks up the Mux hierarchy (via parent pointers)
@@ -72,23 +152,24 @@ func chain(middlewares []func(RouteHandler) RouteHandler, endpoint RouteHandler)
 // Handle registers a handler for an exact match of the pattern string.
 // It applies the middleware stack collected from the Mux hierarchy to the handler
 // before storing it. If the Mux is part of a group, the route is also copied
-// to the parent Mux's corresponding map.
+// to every ancestor Mux's corresponding map. Handle panics if a different
+// pattern is already registered under the same normalized text (see
+// WithNormalizer).
 func (m *Mux) Handle(pattern string, h RouteHandler, t TypeHandling) {
 	allMiddlewares := m.collectMiddlewares()
-	finalHandler := chain(allMiddlewares, h)
-
-	switch t {
-	case TextHandle:
-		m.exactTextRoutes[pattern] = finalHandler
-		if p := m.parent; p != nil {
-			p.exactTextRoutes[pattern] = finalHandler
-		}
-	case CallbackHandle:
-		m.exactCallbackRoutes[pattern] = finalHandler
-		if p := m.parent; p != nil {
-			p.exactCallbackRoutes[pattern] = finalHandler
-		}
+	key, norm := m.exactKey(pattern, t)
+	m.checkExactKey(key, t, pattern, norm)
+	entry := exactEntry{
+		handler:   chain(allMiddlewares, h),
+		responses: m.collectResponseMiddlewares(),
+		mux:       m,
+		info:      RouteInfo{Name: m.routeName(pattern), Pattern: pattern, Type: t, Limiter: m.routeLimiter()},
+		norm:      norm,
 	}
+
+	m.updateRoutes(func(rt *routeTable) {
+		rt.exact(t)[key] = entry
+	})
 }
 
 // HandleFunc is a convenience method for registering a telebot.HandlerFunc
@@ -100,7 +181,7 @@ func (m *Mux) HandleFunc(pattern string, fn telebot.HandlerFunc, t TypeHandling)
 
 // HandleRegexp registers a handler for a pattern defined by a compiled regular expression.
 // It applies the middleware stack collected from the Mux hierarchy to the handler.
-// If the Mux is part of a group, the route is also copied to the parent Mux's
+// If the Mux is part of a group, the route is also copied to every ancestor Mux's
 // corresponding slice. The pattern must not be nil.
 func (m *Mux) HandleRegexp(pattern *regexp.Regexp, h RouteHandler, t TypeHandling) {
 	if pattern == nil {
@@ -110,22 +191,25 @@ func (m *Mux) HandleRegexp(pattern *regexp.Regexp, h RouteHandler, t TypeHandlin
 	finalHandler := chain(allMiddlewares, h)
 
 	entry := regexEntry{
-		regex:   pattern,
-		handler: finalHandler,
+		regex:     pattern,
+		handler:   finalHandler,
+		responses: m.collectResponseMiddlewares(),
+		mux:       m,
+		info: RouteInfo{
+			Name:    m.routeName(pattern.String()),
+			Pattern: pattern.String(),
+			Type:    t,
+			Regexp:  true,
+			Limiter: m.routeLimiter(),
+		},
 	}
-
-	switch t {
-	case TextHandle:
-		m.regexTextRoutes = append(m.regexTextRoutes, entry)
-		if p := m.parent; p != nil {
-			p.regexTextRoutes = append(p.regexTextRoutes, entry)
-		}
-	case CallbackHandle:
-		m.regexCallbackRoutes = append(m.regexCallbackRoutes, entry)
-		if p := m.parent; p != nil {
-			p.regexCallbackRoutes = append(p.regexCallbackRoutes, entry)
-		}
+	if t == TextHandle {
+		entry.norm = m.routeNormalization()
 	}
+
+	m.updateRoutes(func(rt *routeTable) {
+		rt.setRegex(t, append(rt.regex(t), entry))
+	})
 }
 
 // HandleFuncRegexp is a convenience method for registering a telebot.HandlerFunc
@@ -191,18 +275,99 @@ func (m *Mux) Use(middlewares ...func(RouteHandler) RouteHandler) {
 // allowing it to collect the parent's middleware when its own Handle/HandleRegexp
 // methods are called. Middlewares passed to With are added to the new Mux's stack.
 func (m *Mux) With(middlewares ...func(RouteHandler) RouteHandler) Router {
+	return m.newChild(nil, middlewares)
+}
+
+// newChild creates a sub-router of m with the given scope and middlewares and
+// records it in m's children so scoped fallbacks can be resolved from the root.
+func (m *Mux) newChild(scope func(input string) bool, middlewares []func(RouteHandler) RouteHandler) *Mux {
 	nm := &Mux{
-		parent:              m,
-		middlewares:         middlewares,
-		exactTextRoutes:     make(map[string]RouteHandler),
-		exactCallbackRoutes: make(map[string]RouteHandler),
-		regexTextRoutes:     make([]regexEntry, 0),
-		regexCallbackRoutes: make([]regexEntry, 0),
-		notFoundHandler:     m.notFoundHandler,
+		settings:    m.settings,
+		parent:      m,
+		scope:       scope,
+		middlewares: middlewares,
 	}
+	nm.table.Store(newRouteTable())
+
+	m.mu.Lock()
+	m.children = append(m.children, nm)
+	m.mu.Unlock()
 	return nm
 }
 
+// Named creates a new Mux sub-router similar to With whose routes are
+// registered under the given name instead of their pattern. Several routes
+// can share a name, so they can be disabled and enabled together as a feature.
+func (m *Mux) Named(name string) Router {
+	nm := m.newChild(nil, nil)
+	nm.name = name
+	return nm
+}
+
+// Remove deletes the routes of the given type whose pattern (the exact
+// pattern or the source of the regular expression) equals pattern from the
+// whole router hierarchy and reports whether any route was deleted.
+func (m *Mux) Remove(pattern string, t TypeHandling) bool {
+	removed := false
+	var walk func(current *Mux)
+	walk = func(current *Mux) {
+		current.mu.Lock()
+		rt := current.routes().clone()
+		if rt.remove(pattern, t) {
+			removed = true
+			current.table.Store(rt)
+		}
+		current.mu.Unlock()
+		for _, child := range current.childList() {
+			walk(child)
+		}
+	}
+	walk(m.root())
+	return removed
+}
+
+// Disable disables every route registered under name (see Named); disabled
+// routes are treated as if they were not registered. The route name of an
+// unnamed route is its pattern.
+func (m *Mux) Disable(name string) {
+	m.settings.setDisabled(name, true)
+}
+
+// Enable enables the routes registered under name again.
+func (m *Mux) Enable(name string) {
+	m.settings.setDisabled(name, false)
+}
+
+// Routes returns information about every route registered on the Mux and
+// its sub-routers, exact routes first.
+func (m *Mux) Routes() []RouteInfo {
+	rt := m.routes()
+	var infos []RouteInfo
+	for _, t := range []TypeHandling{TextHandle, CallbackHandle} {
+		exact := make([]RouteInfo, 0, len(rt.exact(t)))
+		for _, entry := range rt.exact(t) {
+			exact = append(exact, entry.info)
+		}
+		sort.Slice(exact, func(i, j int) bool { return exact[i].Pattern < exact[j].Pattern })
+		infos = append(infos, exact...)
+	}
+	for _, t := range []TypeHandling{TextHandle, CallbackHandle} {
+		for _, entry := range rt.regex(t) {
+			infos = append(infos, entry.info)
+		}
+	}
+	return infos
+}
+
+// root returns the topmost Mux of the hierarchy m belongs to.
+func (m *Mux) root() *Mux {
+	current := m
+	for current.parent != nil {
+		current = current.parent
+	}
+	return current
+}
+
 // Group creates a new Mux sub-router (inline group) similar to With.
 // It executes the provided function `fn` with the new sub-router, allowing
 // for convenient route definition within the group's scope. Middlewares applied
@@ -215,23 +380,75 @@ func (m *Mux) Group(fn func(r Router)) Router {
 	return im
 }
 
+// Scope creates a sub-router like Group whose scope covers every input that
+// starts with prefix. When such an input is not handled, the NotFound handler
+// of the scope is used instead of the global one. For callbacks the leading
+// "\f" that telebot adds to unique button data is ignored.
+func (m *Mux) Scope(prefix string, fn func(r Router)) Router {
+	return m.scoped(func(input string) bool {
+		return strings.HasPrefix(strings.TrimPrefix(input, "\f"), prefix)
+	}, fn)
+}
+
+// ScopeRegexp is like Scope, but the scope covers every input matched by pattern.
+// The pattern must not be nil.
+func (m *Mux) ScopeRegexp(pattern *regexp.Regexp, fn func(r Router)) Router {
+	if pattern == nil {
+		panic("router: ScopeRegexp called with nil pattern")
+	}
+	return m.scoped(pattern.MatchString, fn)
+}
+
+// scoped creates a scoped sub-router and executes fn with it.
+func (m *Mux) scoped(scope func(input string) bool, fn func(r Router)) Router {
+	sm := m.newChild(scope, nil)
+	if fn != nil {
+		fn(sm)
+	}
+	return sm
+}
+
 // NotFound sets the handler function to be called when no route matches.
-// The handler is stored on the current Mux instance.
+// The handler is stored on the current Mux instance. A NotFound handler set on
+// a group is used for unhandled inputs that match one of the group's routes
+// or fall into its scope (see Scope).
 func (m *Mux) NotFound(h telebot.HandlerFunc) {
 	m.notFoundHandler = h
 }
 
-// findNotFoundHandler searches for a configured NotFound handler by walking
-// up the Mux hierarchy via the parent pointer. If no custom handler is found,
-// it returns a default handler that simply returns ErrNotFound.
-func (m *Mux) findNotFoundHandler() telebot.HandlerFunc {
+// Forbidden sets the handler function to be called when a middleware or
+// handler denies access to a matched route by returning ErrForbidden (see Deny).
+// Like NotFound, a Forbidden handler set on a group is scoped to that group.
+func (m *Mux) Forbidden(h telebot.HandlerFunc) {
+	m.forbiddenHandler = h
+}
+
+// UnsupportedUpdate sets the handler function to be called for updates that
+// are neither text messages nor callback queries.
+func (m *Mux) UnsupportedUpdate(h telebot.HandlerFunc) {
+	m.unsupportedHandler = h
+}
+
+// findHandler searches for a handler selected by get by walking up the Mux
+// hierarchy via the parent pointer. It returns nil if no handler is configured.
+func (m *Mux) findHandler(get func(m *Mux) telebot.HandlerFunc) telebot.HandlerFunc {
 	current := m
 	for current != nil {
-		if current.notFoundHandler != nil {
-			return current.notFoundHandler
+		if h := get(current); h != nil {
+			return h
 		}
 		current = current.parent
 	}
+	return nil
+}
+
+// findNotFoundHandler searches for a configured NotFound handler by walking
+// up the Mux hierarchy via the parent pointer. If no custom handler is found,
+// it returns a default handler that simply returns ErrNotFound.
+func (m *Mux) findNotFoundHandler() telebot.HandlerFunc {
+	if h := m.findHandler(func(m *Mux) telebot.HandlerFunc { return m.notFoundHandler }); h != nil {
+		return h
+	}
 	return func(ctx telebot.Context) error {
 		return ErrNotFound
 	}
@@ -243,68 +460,257 @@ func (m *Mux) NotFoundHandler() telebot.HandlerFunc {
 	return m.findNotFoundHandler()
 }
 
+// ForbiddenHandler returns the appropriate Forbidden handler for this Mux,
+// searching up the hierarchy if necessary. If no custom handler is found,
+// it returns a default handler that silently drops the update.
+func (m *Mux) ForbiddenHandler() telebot.HandlerFunc {
+	if h := m.findHandler(func(m *Mux) telebot.HandlerFunc { return m.forbiddenHandler }); h != nil {
+		return h
+	}
+	return func(ctx telebot.Context) error {
+		return nil
+	}
+}
+
+// UnsupportedUpdateHandler returns the appropriate UnsupportedUpdate handler
+// for this Mux, searching up the hierarchy if necessary. If no custom handler
+// is found, the NotFound handler is used.
+func (m *Mux) UnsupportedUpdateHandler() telebot.HandlerFunc {
+	if h := m.findHandler(func(m *Mux) telebot.HandlerFunc { return m.unsupportedHandler }); h != nil {
+		return h
+	}
+	return m.NotFoundHandler()
+}
+
+// OnError sets the handler that receives errors returned by route handlers
+// together with information about the route that produced them. Like NotFound,
+// an error handler set on a group is scoped to the group's routes.
+// Without a custom handler, DefaultErrorHandler is used.
+func (m *Mux) OnError(h ErrorHandler) {
+	m.errorHandler = h
+}
+
+// handleError passes a non-nil err returned by the route to the nearest
+// error handler in the Mux hierarchy.
+func (m *Mux) handleError(ctx telebot.Context, err error, route RouteInfo) error {
+	if err == nil {
+		return nil
+	}
+	for current := m; current != nil; current = current.parent {
+		if current.errorHandler != nil {
+			return current.errorHandler(ctx, err, route)
+		}
+	}
+	return DefaultErrorHandler(ctx, err, route)
+}
+
+// Deny marks the context as denied and returns ErrForbidden. Middlewares can
+// either return its result or call it and return nil; in both cases the router
+// calls the Forbidden handler instead of NotFound.
+func Deny(ctx telebot.Context) error {
+	if s := stateOf(ctx); s != nil {
+		s.deny()
+	}
+	return ErrForbidden
+}
+
+// fallbackMux determines which Mux in the hierarchy below m is responsible for
+// an unhandled input. It picks the deepest sub-router whose scope matches the
+// input; if the route that matched the input was registered on a descendant
+// of that sub-router, the route's Mux is used instead.
+func (m *Mux) fallbackMux(input string, matched *Mux) *Mux {
+	best, bestDepth := m, 0
+	var walk func(current *Mux, depth int)
+	walk = func(current *Mux, depth int) {
+		for _, child := range current.childList() {
+			if child.scope != nil {
+				if !child.scope(input) {
+					continue
+				}
+				if depth+1 > bestDepth {
+					best, bestDepth = child, depth+1
+				}
+			}
+			walk(child, depth+1)
+		}
+	}
+	walk(m, 0)
+
+	for current := matched; current != nil; current = current.parent {
+		if current == best {
+			return matched
+		}
+	}
+	return best
+}
+
 // ServeContext is the main entry point for processing telebot updates.
-// It determines the type of update (Text or Callback), finds a matching
+// It dispatches the update (see Dispatch) and returns only the error.
+// If the Mux was created with WithExecutor, the update is queued instead and
+// ServeContext only returns an error if the executor rejects it. After
+// Shutdown has been called, ServeContext answers updates with the message set
+// by WithShutdownMessage, or rejects them with ErrShuttingDown if there is none.
+// Duplicate updates are dropped if WithUpdateDeduplication is used.
+func (m *Mux) ServeContext(ctx telebot.Context) error {
+	if dedup := m.settings.updateDedup; dedup != nil {
+		if duplicate, err := dedup(ctx); err != nil || duplicate {
+			return err
+		}
+	}
+
+	lc := &m.settings.lifecycle
+	if !lc.acquire() {
+		if msg := m.settings.shutdownMessage; msg != "" {
+			return SendUserMessage(ctx, msg)
+		}
+		return ErrShuttingDown
+	}
+
+	e := m.settings.executor
+	if input, t, ok := updateInput(ctx); e == nil || (ok && m.isCancelRoute(input, t)) {
+		defer lc.release()
+		_, err := m.Dispatch(ctx)
+		return err
+	}
+	return e.submit(e.cfg.Key(ctx), job{
+		run: func() {
+			defer lc.release()
+			if _, err := m.Dispatch(ctx); err != nil {
+				e.cfg.OnError(ctx, err)
+			}
+		},
+		discard: lc.release,
+	})
+}
+
+// Dispatch determines the type of update (Text or Callback), finds a matching
 // handler (first checking exact matches, then regular expressions), executes
 // the handler (which includes the pre-applied middleware chain), and returns
-// the result. If no handler is found, it calls the NotFound handler.
-func (m *Mux) ServeContext(ctx telebot.Context) error {
-	var input string
-	var exactMap map[string]RouteHandler
-	var regexSlice []regexEntry
-
-	cb := ctx.Callback()
-	msg := ctx.Message()
-
-	if cb != nil {
-		input = cb.Data
-		exactMap = m.exactCallbackRoutes
-		regexSlice = m.regexCallbackRoutes
-	} else if msg != nil && msg.Text != "" {
-		input = msg.Text
-		exactMap = m.exactTextRoutes
-		regexSlice = m.regexTextRoutes
+// a Result describing how the update was processed along with the handler's
+// error. A handler returning ErrSkip passes the update to the next candidate.
+// Unless implicit fallthrough is disabled (see WithImplicitFallthrough), so
+// does a handler that returns without responding. If no handler is found,
+// Dispatch calls the NotFound handler; if access was denied, it calls the
+// Forbidden handler; updates that carry neither text nor callback data are
+// passed to the UnsupportedUpdate handler.
+func (m *Mux) Dispatch(ctx telebot.Context) (Result, error) {
+	start := time.Now()
+
+	var goCtx context.Context
+	var cancel context.CancelFunc
+	if m.settings.handlerTimeout > 0 {
+		goCtx, cancel = context.WithTimeout(m.settings.baseContext, m.settings.handlerTimeout)
 	} else {
-		return m.NotFoundHandler()(ctx)
+		goCtx, cancel = context.WithCancel(m.settings.baseContext)
 	}
+	defer cancel()
 
 	// wrapping context
-	wasHandled := false
-	markHandled := func() {
-		wasHandled = true
-	}
-	apiWithMark := &wrappedBot{
-		API:         ctx.Bot(),
-		markHandled: markHandled,
-	}
+	st := &state{settings: m.settings, goCtx: goCtx, policy: m.settings.handledPolicy}
+	chat := chatID(ctx)
+	m.settings.inflight.add(chat, st, cancel)
+	defer m.settings.inflight.done(chat, st)
 	ctxWrapped := &wrappedContext{
 		Context: ctx,
-		api:     apiWithMark,
+		api:     &wrappedBot{API: ctx.Bot(), state: st, throttle: m.settings.throttle},
+		state:   st,
 	}
+	ctxWrapped.api.ctx = ctxWrapped
+
+	var result Result
+	finish := func(err error) (Result, error) {
+		result.Handled = st.wasHandled()
+		result.Actions = st.actionCount()
+		result.Duration = time.Since(start)
+		return result, err
+	}
+	fallback := func(kind MatchKind, fm *Mux, h telebot.HandlerFunc) (Result, error) {
+		result.Match = kind
+		st.responses = fm.collectResponseMiddlewares()
+		return finish(h(ctxWrapped))
+	}
+
+	input, t, ok := updateInput(ctx)
+	if !ok {
+		return fallback(MatchUnsupported, m, m.UnsupportedUpdateHandler())
+	}
+	rt := m.routes()
+	exactMap := rt.exact(t)
+	regexSlice := rt.regex(t)
+	disabled := m.settings.disabledNames()
 
 	// handling
-	if handler, ok := exactMap[input]; ok {
-		err := handler.ServeContext(ctxWrapped)
-		if ctxWrapped.handled || wasHandled {
-			return err
+	var matched *Mux
+
+	if entry, ok := m.lookupExact(exactMap, input, t); ok && !disabled[entry.info.Name] {
+		matched = entry.mux
+		st.route = entry.info
+		st.responses = entry.responses
+		result.Route = entry.info
+		err := entry.handler.ServeContext(ctxWrapped)
+		switch {
+		case st.wasDenied() || errors.Is(err, ErrForbidden):
+			fm := m.fallbackMux(input, matched)
+			return fallback(MatchForbidden, fm, fm.ForbiddenHandler())
+		case errors.Is(err, ErrSkip):
+			st.setHandled(false)
+		case !m.settings.implicitFallthrough || err != nil || st.wasHandled():
+			result.Match = MatchExact
+			return finish(entry.mux.handleError(ctxWrapped, err, entry.info))
 		}
 	}
 
 	for _, entry := range regexSlice {
-		if entry.regex.MatchString(input) {
-			if err := entry.handler.ServeContext(ctxWrapped); err != nil {
-				return err
-			}
-			if ctxWrapped.handled || wasHandled {
-				return nil
-			}
+		if disabled[entry.info.Name] {
+			continue
+		}
+		subject := input
+		if entry.norm != nil {
+			subject = entry.norm.apply(input)
+		}
+		captures := entry.regex.FindStringSubmatch(subject)
+		if captures == nil {
+			continue
+		}
+		if matched == nil {
+			matched = entry.mux
+		}
+		st.route = entry.info
+		st.responses = entry.responses
+		result.Route = entry.info
+		result.Captures = captures
+		err := entry.handler.ServeContext(ctxWrapped)
+		switch {
+		case st.wasDenied() || errors.Is(err, ErrForbidden):
+			fm := m.fallbackMux(input, entry.mux)
+			return fallback(MatchForbidden, fm, fm.ForbiddenHandler())
+		case errors.Is(err, ErrSkip):
+			st.setHandled(false)
+		case !m.settings.implicitFallthrough || err != nil || st.wasHandled():
+			result.Match = MatchRegexp
+			return finish(entry.mux.handleError(ctxWrapped, err, entry.info))
 		}
 	}
 
-	if !ctxWrapped.handled && !wasHandled {
-		return m.NotFoundHandler()(ctx)
+	if !st.wasHandled() {
+		result.Route = RouteInfo{}
+		result.Captures = nil
+		fm := m.fallbackMux(input, matched)
+		return fallback(MatchNotFound, fm, fm.NotFoundHandler())
 	}
-	return nil
+	return finish(nil)
+}
+
+// updateInput returns the callback data or message text of ctx and the type
+// of the update. It reports false for updates that carry neither.
+func updateInput(ctx telebot.Context) (string, TypeHandling, bool) {
+	if cb := ctx.Callback(); cb != nil {
+		return cb.Data, CallbackHandle, true
+	}
+	if msg := ctx.Message(); msg != nil && msg.Text != "" {
+		return msg.Text, TextHandle, true
+	}
+	return "", 0, false
 }
 
 // HandlerFunc is an adapter type that allows a regular telebot.HandlerFunc
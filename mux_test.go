@@ -1,10 +1,19 @@
 package router
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	tb "gopkg.in/telebot.v4"
+	"io"
+	"log"
 	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func TestMux(t *testing.T) {
@@ -135,6 +144,323 @@ func TestMux(t *testing.T) {
 		assert.Contains(t, ctx.sent, "not found from ghost")
 	})
 
+	t.Run("Forbidden Called On Deny", func(t *testing.T) {
+		mux := NewRouter()
+		mux.NotFound(func(ctx tb.Context) error {
+			return ctx.Send("not found")
+		})
+		mux.Forbidden(func(ctx tb.Context) error {
+			return ctx.Send("forbidden")
+		})
+
+		deny := func(next RouteHandler) RouteHandler {
+			return HandlerFunc(func(ctx tb.Context) error {
+				return Deny(ctx)
+			})
+		}
+		mux.With(deny).HandleFuncText("/admin", func(ctx tb.Context) error {
+			return ctx.Send("admin")
+		})
+
+		ctx := &mockContext{text: "/admin"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"forbidden"}, ctx.sent)
+	})
+
+	t.Run("Unsupported Update", func(t *testing.T) {
+		mux := NewRouter()
+		mux.NotFound(func(ctx tb.Context) error {
+			return ctx.Send("not found")
+		})
+		mux.UnsupportedUpdate(func(ctx tb.Context) error {
+			return ctx.Send("unsupported")
+		})
+
+		ctx := &mockContext{}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"unsupported"}, ctx.sent)
+	})
+
+	t.Run("ErrSkip Passes To Next Route", func(t *testing.T) {
+		mux := NewRouter(WithImplicitFallthrough(false))
+		mux.HandleFuncText("/item 1", func(ctx tb.Context) error {
+			return ErrSkip
+		})
+		mux.HandleFuncRegexpText(regexp.MustCompile(`^/item \d+$`), func(ctx tb.Context) error {
+			return ctx.Send("item")
+		})
+
+		ctx := &mockContext{text: "/item 1"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"item"}, ctx.sent)
+	})
+
+	t.Run("Implicit Fallthrough Disabled", func(t *testing.T) {
+		mux := NewRouter(WithImplicitFallthrough(false))
+		mux.NotFound(func(ctx tb.Context) error {
+			return ctx.Send("not found")
+		})
+		mux.HandleFuncText("/silent", func(ctx tb.Context) error {
+			return nil
+		})
+
+		ctx := &mockContext{text: "/silent"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Empty(t, ctx.sent)
+	})
+
+	t.Run("OnError Receives Route", func(t *testing.T) {
+		mux := NewRouter()
+		boom := errors.New("boom")
+		var got RouteInfo
+		var current RouteInfo
+		mux.OnError(func(ctx tb.Context, err error, route RouteInfo) error {
+			got = route
+			assert.Equal(t, boom, err)
+			var ok bool
+			current, ok = CurrentRoute(ctx)
+			assert.True(t, ok)
+			return ctx.Reply("failed")
+		})
+		mux.HandleFuncRegexpText(regexp.MustCompile(`^/fail$`), func(ctx tb.Context) error {
+			return boom
+		})
+
+		ctx := &mockContext{text: "/fail"}
+		result, err := mux.Dispatch(ctx)
+		assert.NoError(t, err)
+		want := RouteInfo{Name: "^/fail$", Pattern: "^/fail$", Type: TextHandle, Regexp: true}
+		assert.Equal(t, want, got)
+		assert.Equal(t, want, current)
+		assert.True(t, result.Handled)
+		assert.Equal(t, 1, result.Actions)
+		assert.Equal(t, []string{"reply:failed"}, ctx.sent)
+	})
+
+	t.Run("UserError Delivered To User", func(t *testing.T) {
+		mux := NewRouter()
+		mux.HandleFuncCallback("order", func(ctx tb.Context) error {
+			return NewUserError("out of stock")
+		})
+		mux.HandleFuncText("/order", func(ctx tb.Context) error {
+			return NewUserError("out of stock")
+		})
+
+		ctx := &mockContext{callback: "order"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"alert:out of stock"}, ctx.sent)
+
+		ctx = &mockContext{text: "/order"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"reply:out of stock"}, ctx.sent)
+	})
+
+	t.Run("Recoverer Converts Panic", func(t *testing.T) {
+		mux := NewRouter()
+		mux.Use(RecovererWithConfig(RecovererConfig{UserMessage: "oops", AdminChat: &tb.Chat{ID: 1}}))
+		var got error
+		mux.OnError(func(ctx tb.Context, err error, route RouteInfo) error {
+			got = err
+			return nil
+		})
+		mux.HandleFuncText("/panic", func(ctx tb.Context) error {
+			panic("boom")
+		})
+
+		ctx := &mockContext{text: "/panic"}
+		assert.NoError(t, mux.ServeContext(ctx))
+
+		var panicErr *PanicError
+		if assert.True(t, errors.As(got, &panicErr)) {
+			assert.Equal(t, "boom", panicErr.Value)
+			assert.Equal(t, "/panic", panicErr.Route.Pattern)
+			assert.NotEmpty(t, panicErr.Stack)
+		}
+		assert.Equal(t, []string{"reply:oops"}, ctx.sent)
+		assert.True(t, panicErr.Reported)
+		if assert.Len(t, ctx.botSent, 1) {
+			assert.Contains(t, ctx.botSent[0], `router: panic in route "/panic" (update 1): boom`)
+		}
+
+		mux.HandleFuncText("/long", func(ctx tb.Context) error {
+			panic(strings.Repeat("é", maxPanicReportLen))
+		})
+		ctx = &mockContext{text: "/long"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		if assert.Len(t, ctx.botSent, 1) {
+			assert.True(t, utf8.ValidString(ctx.botSent[0].(string)))
+			assert.LessOrEqual(t, len(ctx.botSent[0].(string)), maxPanicReportLen)
+		}
+
+		ctx = &mockContext{text: "/panic", botErr: errors.New("bad request")}
+		assert.NoError(t, mux.ServeContext(ctx))
+		if assert.True(t, errors.As(got, &panicErr)) {
+			assert.EqualError(t, panicErr.ReportErr, "bad request")
+		}
+
+		mux.OnError(UserFacingErrorHandler("generic", log.New(io.Discard, "", 0)))
+		ctx = &mockContext{text: "/panic"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"reply:oops"}, ctx.sent)
+	})
+
+	t.Run("MarkHandled Through Wrapped Context", func(t *testing.T) {
+		mux := NewRouter()
+		mux.NotFound(func(ctx tb.Context) error {
+			return ctx.Send("not found")
+		})
+		mux.Use(func(next RouteHandler) RouteHandler {
+			return HandlerFunc(func(ctx tb.Context) error {
+				return next.ServeContext(&customContext{Context: ctx})
+			})
+		})
+		mux.HandleFuncText("/quiet", func(ctx tb.Context) error {
+			assert.False(t, WasHandled(ctx))
+			MarkHandled(ctx)
+			assert.True(t, WasHandled(ctx))
+			return nil
+		})
+
+		ctx := &mockContext{text: "/quiet"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Empty(t, ctx.sent)
+	})
+
+	t.Run("Handled Policy", func(t *testing.T) {
+		mux := NewRouter(WithHandledPolicy(HandledExcept("Send")))
+		mux.NotFound(func(ctx tb.Context) error {
+			return ctx.Reply("not found")
+		})
+		mux.HandleFuncText("/bot", func(ctx tb.Context) error {
+			_, err := ctx.Bot().Send(ctx.Recipient(), "ignored")
+			return err
+		})
+
+		ctx := &mockContext{text: "/bot"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.True(t, ctx.marked)
+		assert.Equal(t, []string{"reply:not found"}, ctx.sent)
+	})
+
+	t.Run("Dispatch Result", func(t *testing.T) {
+		mux := NewRouter()
+		mux.HandleFuncRegexpText(regexp.MustCompile(`^/user (\d+)$`), func(ctx tb.Context) error {
+			return ctx.Send("user")
+		})
+
+		result, err := mux.Dispatch(&mockContext{text: "/user 42"})
+		assert.NoError(t, err)
+		assert.Equal(t, MatchRegexp, result.Match)
+		assert.Equal(t, "^/user (\\d+)$", result.Route.Pattern)
+		assert.Equal(t, []string{"/user 42", "42"}, result.Captures)
+		assert.True(t, result.Handled)
+		assert.Equal(t, 1, result.Actions)
+
+		result, err = mux.Dispatch(&mockContext{text: "/unknown"})
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, MatchNotFound, result.Match)
+		assert.True(t, result.Match.IsFallback())
+		assert.False(t, result.Handled)
+	})
+
+	t.Run("Remove Route", func(t *testing.T) {
+		mux := NewRouter()
+		mux.Group(func(r Router) {
+			r.HandleFuncText("/old", func(ctx tb.Context) error {
+				return ctx.Send("old")
+			})
+		})
+
+		assert.True(t, mux.Remove("/old", TextHandle))
+		assert.False(t, mux.Remove("/old", TextHandle))
+
+		ctx := &mockContext{text: "/old"}
+		assert.ErrorIs(t, mux.ServeContext(ctx), ErrNotFound)
+		assert.Empty(t, mux.Routes())
+	})
+
+	t.Run("Disable And Enable Named Routes", func(t *testing.T) {
+		mux := NewRouter()
+		reports := mux.Named("reports")
+		reports.HandleFuncText("/report", func(ctx tb.Context) error {
+			return ctx.Send("report")
+		})
+		reports.HandleFuncCallback("report:again", func(ctx tb.Context) error {
+			return ctx.Send("report")
+		})
+
+		mux.Disable("reports")
+		assert.ErrorIs(t, mux.ServeContext(&mockContext{text: "/report"}), ErrNotFound)
+		assert.ErrorIs(t, mux.ServeContext(&mockContext{callback: "report:again"}), ErrNotFound)
+
+		mux.Enable("reports")
+		ctx := &mockContext{text: "/report"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"report"}, ctx.sent)
+	})
+
+	t.Run("Concurrent Registration", func(t *testing.T) {
+		mux := NewRouter()
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				mux.HandleFuncText(fmt.Sprintf("/cmd%d", i), func(ctx tb.Context) error {
+					return ctx.Send("ok")
+				})
+			}(i)
+			go func() {
+				defer wg.Done()
+				_ = mux.ServeContext(&mockContext{text: "/cmd0"})
+			}()
+		}
+		wg.Wait()
+		assert.Len(t, mux.Routes(), 10)
+	})
+
+	t.Run("Register Controller", func(t *testing.T) {
+		mux := NewRouter()
+		var trace []string
+		mux.RegisterController(&ordersController{trace: &trace})
+
+		ctx := &mockContext{text: "/orders@shop_bot last"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"list"}, ctx.sent)
+
+		ctx = &mockContext{callback: "orders:new"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"create"}, ctx.sent)
+		assert.Equal(t, []string{"controller", "controller"}, trace)
+
+		assert.ErrorIs(t, mux.ServeContext(&mockContext{text: "/ordersX"}), ErrNotFound)
+
+		// Routes without Callback match text messages.
+		ctx = &mockContext{text: "/help"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"help"}, ctx.sent)
+		assert.ErrorIs(t, mux.ServeContext(&mockContext{callback: "/help"}), ErrNotFound)
+	})
+
+	t.Run("Go Context Propagation", func(t *testing.T) {
+		type key struct{}
+		base := context.WithValue(context.Background(), key{}, "value")
+		mux := NewRouter(WithBaseContext(base))
+
+		var goCtx context.Context
+		mux.With(Timeout(time.Minute)).HandleFuncText("/db", func(ctx tb.Context) error {
+			goCtx = GoContext(ctx)
+			_, hasDeadline := goCtx.Deadline()
+			assert.True(t, hasDeadline)
+			assert.Equal(t, "value", goCtx.Value(key{}))
+			return ctx.Send("ok")
+		})
+
+		assert.NoError(t, mux.ServeContext(&mockContext{text: "/db"}))
+		assert.ErrorIs(t, goCtx.Err(), context.Canceled)
+		assert.Equal(t, context.Background(), GoContext(&mockContext{}))
+	})
+
 	t.Run("Group Middleware Inheritance", func(t *testing.T) {
 		mux := NewRouter()
 		var trace []string
@@ -165,13 +491,140 @@ func TestMux(t *testing.T) {
 		assert.Equal(t, []string{"root", "group", "handler"}, trace)
 		assert.Contains(t, ctx.sent, "hi")
 	})
+
+	t.Run("Scoped NotFound", func(t *testing.T) {
+		mux := NewRouter()
+		mux.NotFound(func(ctx tb.Context) error {
+			return ctx.Send("global not found")
+		})
+
+		mux.Scope("admin:", func(r Router) {
+			r.HandleFuncCallback("admin:ban", func(ctx tb.Context) error {
+				return ctx.Send("banned")
+			})
+			r.NotFound(func(ctx tb.Context) error {
+				return ctx.Send("admin not found")
+			})
+		})
+
+		ctx := &mockContext{callback: "\fadmin:kick"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"admin not found"}, ctx.sent)
+
+		ctx = &mockContext{callback: "user:kick"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"global not found"}, ctx.sent)
+	})
+
+	t.Run("Group NotFound For Unhandled Route", func(t *testing.T) {
+		mux := NewRouter()
+		mux.NotFound(func(ctx tb.Context) error {
+			return ctx.Send("global not found")
+		})
+
+		mux.Group(func(r Router) {
+			r.Use(func(next RouteHandler) RouteHandler {
+				return HandlerFunc(func(ctx tb.Context) error {
+					return nil
+				})
+			})
+			r.With().HandleFuncText("/nested", func(ctx tb.Context) error {
+				return ctx.Send("nested")
+			})
+			r.NotFound(func(ctx tb.Context) error {
+				return ctx.Send("group not found")
+			})
+		})
+
+		ctx := &mockContext{text: "/nested"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"group not found"}, ctx.sent)
+	})
+
+	t.Run("Normalization", func(t *testing.T) {
+		mux := NewRouter(WithNormalizer(NFC, StripEmoji, CollapseSpace, FoldCase))
+		mux.NotFound(func(ctx tb.Context) error {
+			return ctx.Send("not found")
+		})
+		mux.HandleFuncText("/start", func(ctx tb.Context) error {
+			return ctx.Send("start:" + ctx.Message().Text)
+		})
+		mux.HandleFuncText("⚙️ Settings", func(ctx tb.Context) error {
+			return ctx.Send("settings")
+		})
+		mux.HandleFuncRegexpText(regexp.MustCompile(`^/echo (.+)$`), func(ctx tb.Context) error {
+			return ctx.Send("echo")
+		})
+		mux.HandleFuncText("caf\u00e9", func(ctx tb.Context) error {
+			return ctx.Send("cafe")
+		})
+		mux.Normalize().HandleFuncText("/Exact", func(ctx tb.Context) error {
+			return ctx.Send("exact")
+		})
+
+		tests := []struct{ text, want string }{
+			{"/Start  ", "start:/Start  "},
+			{"settings", "settings"},
+			{"🔧  SETTINGS", "settings"},
+			{"/ECHO   hi", "echo"},
+			{"Cafe\u0301", "cafe"},
+			{"/Exact", "exact"},
+			{"/exact", "not found"},
+		}
+		for _, tt := range tests {
+			ctx := &mockContext{text: tt.text}
+			assert.NoError(t, mux.ServeContext(ctx))
+			assert.Equal(t, []string{tt.want}, ctx.sent, tt.text)
+		}
+
+		assert.Panics(t, func() {
+			mux.HandleFuncText("/START", func(ctx tb.Context) error { return nil })
+		})
+		assert.Panics(t, func() {
+			mux.Normalize().HandleFuncText("/start", func(ctx tb.Context) error { return nil })
+		})
+		assert.NotPanics(t, func() {
+			mux.HandleFuncText("/start", func(ctx tb.Context) error { return nil })
+		})
+	})
+}
+
+type ordersController struct {
+	trace *[]string
+}
+
+func (c *ordersController) Routes() []RouteDescriptor {
+	return []RouteDescriptor{
+		{Command: "/orders", Handler: c.list},
+		{Callback: true, Pattern: "orders:new", Name: "orders", Handler: c.create},
+		{Pattern: "/help", Handler: c.help},
+	}
 }
 
+func (c *ordersController) Middlewares() []func(RouteHandler) RouteHandler {
+	return []func(RouteHandler) RouteHandler{func(next RouteHandler) RouteHandler {
+		return HandlerFunc(func(ctx tb.Context) error {
+			*c.trace = append(*c.trace, "controller")
+			return next.ServeContext(ctx)
+		})
+	}}
+}
+
+func (c *ordersController) list(ctx tb.Context) error   { return ctx.Send("list") }
+func (c *ordersController) create(ctx tb.Context) error { return ctx.Send("create") }
+func (c *ordersController) help(ctx tb.Context) error   { return ctx.Send("help") }
+
 type mockContext struct {
 	tb.Context
 	text       string
 	callback   string
+	chat       int64
+	language   string
+	store      map[string]interface{}
 	sent       []string
+	opts       []interface{}
+	botSent    []interface{}
+	botErr     error
 	marked     bool
 	wasHandled bool
 }
@@ -183,15 +636,38 @@ func (m *mockContext) Message() *tb.Message {
 	return &tb.Message{Text: m.text}
 }
 
+func (m *mockContext) Update() tb.Update {
+	return tb.Update{ID: 1}
+}
+
 func (m *mockContext) Callback() *tb.Callback {
 	if m.callback == "" {
 		return nil
 	}
-	return &tb.Callback{Data: m.callback}
+	return &tb.Callback{Data: m.callback, Sender: m.Sender()}
 }
 
-func (m *mockContext) Send(what interface{}, _ ...interface{}) error {
+func (m *mockContext) Send(what interface{}, opts ...interface{}) error {
 	m.sent = append(m.sent, what.(string))
+	m.opts = opts
+	m.wasHandled = true
+	return nil
+}
+
+func (m *mockContext) Reply(what interface{}, _ ...interface{}) error {
+	m.sent = append(m.sent, "reply:"+what.(string))
+	m.wasHandled = true
+	return nil
+}
+
+func (m *mockContext) RespondAlert(text string) error {
+	m.sent = append(m.sent, "alert:"+text)
+	m.wasHandled = true
+	return nil
+}
+
+func (m *mockContext) Respond(_ ...*tb.CallbackResponse) error {
+	m.sent = append(m.sent, "respond")
 	m.wasHandled = true
 	return nil
 }
@@ -200,6 +676,39 @@ func (m *mockContext) Bot() tb.API {
 	return dummyBot{ctx: m}
 }
 
+func (m *mockContext) Chat() *tb.Chat {
+	if m.chat == 0 {
+		return nil
+	}
+	return &tb.Chat{ID: m.chat}
+}
+
+func (m *mockContext) Sender() *tb.User {
+	if m.chat == 0 {
+		return nil
+	}
+	return &tb.User{ID: m.chat, LanguageCode: m.language}
+}
+
+func (m *mockContext) Get(key string) interface{} {
+	return m.store[key]
+}
+
+func (m *mockContext) Set(key string, val interface{}) {
+	if m.store == nil {
+		m.store = make(map[string]interface{})
+	}
+	m.store[key] = val
+}
+
+func (m *mockContext) Recipient() tb.Recipient {
+	return &tb.Chat{ID: 1}
+}
+
+type customContext struct {
+	tb.Context
+}
+
 type dummyBot struct {
 	tb.API
 	ctx *mockContext
@@ -207,5 +716,6 @@ type dummyBot struct {
 
 func (b dummyBot) Send(to tb.Recipient, what interface{}, _ ...interface{}) (*tb.Message, error) {
 	b.ctx.marked = true
-	return nil, nil
+	b.ctx.botSent = append(b.ctx.botSent, what)
+	return nil, b.ctx.botErr
 }
@@ -0,0 +1,166 @@
+package router
+
+import (
+	"fmt"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+// Normalizer transforms text before it is matched against routes, see
+// WithNormalizer and Mux.Normalize. Normalizers must be idempotent.
+type Normalizer func(text string) string
+
+// NFC converts text to Unicode Normalization Form C, so precomposed and
+// decomposed forms of the same characters match.
+func NFC(text string) string {
+	return norm.NFC.String(text)
+}
+
+// TrimSpace removes leading and trailing white space.
+func TrimSpace(text string) string {
+	return strings.TrimSpace(text)
+}
+
+// CollapseSpace replaces runs of white space with a single space and removes
+// leading and trailing white space.
+func CollapseSpace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// FoldCase lowercases text, so routes match regardless of case.
+func FoldCase(text string) string {
+	return strings.ToLower(text)
+}
+
+// StripEmoji removes emoji, including skin tone modifiers, variation
+// selectors and joiners, such as the icons prefixing button labels. Combine
+// it with TrimSpace or CollapseSpace to remove the spaces around them.
+func StripEmoji(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.Is(unicode.So, r),
+			r >= 0x1F3FB && r <= 0x1F3FF, // skin tone modifiers
+			r >= 0xFE00 && r <= 0xFE0F,   // variation selectors
+			r == 0x200D, r == 0x20E3:     // zero width joiner, combining keycap
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// normalization is a normalization pipeline. An empty pipeline leaves text
+// unchanged.
+type normalization struct {
+	fns []Normalizer
+}
+
+func (n *normalization) apply(text string) string {
+	for _, fn := range n.fns {
+		text = fn(text)
+	}
+	return text
+}
+
+// newNormalization returns the pipeline of fns and records it so Dispatch
+// tries it on incoming text.
+func (s *settings) newNormalization(fns []Normalizer) *normalization {
+	n := &normalization{fns: fns}
+	if len(fns) > 0 {
+		s.normalizationsMu.Lock()
+		defer s.normalizationsMu.Unlock()
+		current, _ := s.normalizations.Load().([]*normalization)
+		s.normalizations.Store(append(current[:len(current):len(current)], n))
+	}
+	return n
+}
+
+// normalizationList returns the pipelines used by routes.
+func (s *settings) normalizationList() []*normalization {
+	list, _ := s.normalizations.Load().([]*normalization)
+	return list
+}
+
+// WithNormalizer sets the normalization pipeline applied to incoming text
+// and to the patterns of text routes before they are matched, for example
+//
+//	router.WithNormalizer(router.StripEmoji, router.CollapseSpace, router.FoldCase)
+//
+// makes "/Start " match the route "/start" and "⚙️ Settings" match the route
+// "settings". Callback data is never normalized. Handlers still see the
+// original text; regular expressions and their captures see the normalized
+// text. Use Mux.Normalize to change the pipeline of some routes.
+func WithNormalizer(fns ...Normalizer) Option {
+	return func(s *settings) {
+		s.normalization = s.newNormalization(fns)
+	}
+}
+
+// Normalize creates a new Mux sub-router similar to With whose text routes
+// use the normalization pipeline fns instead of the one set with
+// WithNormalizer. Normalize without arguments creates a sub-router whose
+// routes match the text as is.
+func (m *Mux) Normalize(fns ...Normalizer) Router {
+	nm := m.newChild(nil, nil)
+	nm.normalization = m.settings.newNormalization(fns)
+	return nm
+}
+
+// routeNormalization returns the normalization pipeline of the text routes
+// registered on m, or nil if their text is matched as is.
+func (m *Mux) routeNormalization() *normalization {
+	n := m.settings.normalization
+	for current := m; current != nil; current = current.parent {
+		if current.normalization != nil {
+			n = current.normalization
+			break
+		}
+	}
+	if n == nil || len(n.fns) == 0 {
+		return nil
+	}
+	return n
+}
+
+// exactKey returns the key under which an exact route for pattern is stored
+// and its normalization pipeline.
+func (m *Mux) exactKey(pattern string, t TypeHandling) (string, *normalization) {
+	if t != TextHandle {
+		return pattern, nil
+	}
+	n := m.routeNormalization()
+	if n == nil {
+		return pattern, nil
+	}
+	return n.apply(pattern), n
+}
+
+// checkExactKey panics if a route with another pattern or normalization
+// pipeline is already stored under key, which happens when different patterns
+// normalize to the same key. Registering the same pattern again is allowed.
+func (m *Mux) checkExactKey(key string, t TypeHandling, pattern string, norm *normalization) {
+	old, ok := m.root().routes().exact(t)[key]
+	if ok && (old.info.Pattern != pattern || old.norm != norm) {
+		panic(fmt.Sprintf("router: pattern %q collides with pattern %q registered under the same normalized key %q",
+			pattern, old.info.Pattern, key))
+	}
+}
+
+// lookupExact returns the exact route matching input, trying the text as is
+// and then normalized by every pipeline in use.
+func (m *Mux) lookupExact(exact map[string]exactEntry, input string, t TypeHandling) (exactEntry, bool) {
+	// Normalizers are idempotent, so text matching a normalized key as is
+	// also matches it once normalized.
+	if entry, ok := exact[input]; ok {
+		return entry, true
+	}
+	if t != TextHandle {
+		return exactEntry{}, false
+	}
+	for _, n := range m.settings.normalizationList() {
+		if entry, ok := exact[n.apply(input)]; ok && entry.norm == n {
+			return entry, true
+		}
+	}
+	return exactEntry{}, false
+}
@@ -0,0 +1,153 @@
+package router
+
+import (
+	"context"
+	"gopkg.in/telebot.v4"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Option configures a Mux created by NewRouter.
+type Option func(s *settings)
+
+// settings holds the options a Mux was created with and the state shared by
+// the Mux and all of its sub-routers.
+type settings struct {
+	implicitFallthrough bool
+	handledPolicy       HandledPolicy
+	executor            *executor
+	baseContext         context.Context
+	cancelBase          context.CancelFunc
+	handlerTimeout      time.Duration
+	shutdownMessage     string
+	updateDedup         func(ctx telebot.Context) (bool, error)
+	throttle            *throttler
+	defaultLocale       string
+	localeStorage       Storage
+	templates           *Templates
+	catalog             Catalog
+	normalization       *normalization
+	normalizationsMu    sync.Mutex
+	normalizations      atomic.Value // []*normalization
+
+	disabledMu sync.Mutex
+	disabled   atomic.Value // map[string]bool
+
+	inflight     *inflight
+	lifecycle    lifecycle
+	cancelMu     sync.Mutex
+	cancelRoutes map[TypeHandling]map[string]exactEntry
+}
+
+// newSettings returns the default settings with opts applied.
+func newSettings(opts []Option) *settings {
+	s := &settings{
+		implicitFallthrough: true,
+		handledPolicy:       HandledByAll,
+		baseContext:         context.Background(),
+		inflight:            newInflight(),
+		cancelRoutes:        make(map[TypeHandling]map[string]exactEntry),
+		defaultLocale:       "en",
+		localeStorage:       NewMemoryStorage(),
+	}
+	s.disabled.Store(map[string]bool{})
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.baseContext, s.cancelBase = context.WithCancel(s.baseContext)
+	return s
+}
+
+// disabledNames returns the set of disabled route names.
+func (s *settings) disabledNames() map[string]bool {
+	return s.disabled.Load().(map[string]bool)
+}
+
+// setDisabled atomically replaces the set of disabled route names with a copy
+// in which name is added or removed.
+func (s *settings) setDisabled(name string, disabled bool) {
+	s.disabledMu.Lock()
+	defer s.disabledMu.Unlock()
+
+	names := make(map[string]bool)
+	for n := range s.disabledNames() {
+		names[n] = true
+	}
+	if disabled {
+		names[name] = true
+	} else {
+		delete(names, name)
+	}
+	s.disabled.Store(names)
+}
+
+// addCancelRoute records an exact cancel route registered by HandleCancel
+// under its route table key and with its normalization pipeline.
+func (s *settings) addCancelRoute(key string, norm *normalization, t TypeHandling) {
+	s.cancelMu.Lock()
+	defer s.cancelMu.Unlock()
+	if s.cancelRoutes[t] == nil {
+		s.cancelRoutes[t] = make(map[string]exactEntry)
+	}
+	s.cancelRoutes[t][key] = exactEntry{norm: norm}
+}
+
+// WithImplicitFallthrough controls whether a handler that returns without
+// responding (no Send, Edit, Respond, etc.) passes the update on to the next
+// candidate route. It is enabled by default. When disabled, the first matched
+// handler owns the update unless it explicitly returns ErrSkip.
+func WithImplicitFallthrough(enabled bool) Option {
+	return func(s *settings) {
+		s.implicitFallthrough = enabled
+	}
+}
+
+// WithHandledPolicy sets the policy deciding which API calls made by handlers
+// count as having handled an update. The default is HandledByAll.
+// Handlers can always mark an update explicitly with MarkHandled.
+func WithHandledPolicy(policy HandledPolicy) Option {
+	return func(s *settings) {
+		s.handledPolicy = policy
+	}
+}
+
+// WithExecutor makes ServeContext process updates asynchronously with a
+// bounded pool of workers. Updates with the same key (by default, the same
+// chat) are processed one at a time in the order ServeContext received them,
+// while updates with different keys are processed in parallel. Since
+// ServeContext returns before the update is processed, handler errors are
+// passed to cfg.OnError. For strict ordering, create the bot with
+// telebot.Settings.Synchronous set to true, so telebot itself calls
+// ServeContext in order; the executor then provides the parallelism.
+func WithExecutor(cfg ExecutorConfig) Option {
+	return func(s *settings) {
+		s.executor = newExecutor(cfg)
+	}
+}
+
+// WithBaseContext sets the context every update context returned by GoContext
+// is derived from. Cancelling it, for example when the bot is shutting down,
+// cancels the contexts of all updates being processed.
+func WithBaseContext(ctx context.Context) Option {
+	return func(s *settings) {
+		s.baseContext = ctx
+	}
+}
+
+// WithHandlerTimeout sets a deadline of d on the context returned by GoContext
+// for every update. Use the Timeout middleware to configure it per route.
+func WithHandlerTimeout(d time.Duration) Option {
+	return func(s *settings) {
+		s.handlerTimeout = d
+	}
+}
+
+// WithShutdownMessage sets the message sent in reply to updates received
+// after Shutdown has been called, for example "The bot is restarting, please
+// try again in a minute." By default, such updates are rejected silently.
+func WithShutdownMessage(text string) Option {
+	return func(s *settings) {
+		s.shutdownMessage = text
+	}
+}
@@ -0,0 +1,142 @@
+package router
+
+import (
+	"encoding/json"
+	"gopkg.in/telebot.v4"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// QuotaConfig configures the middleware returned by Quota.
+type QuotaConfig struct {
+	// Cooldown is the minimum time between two uses of a key.
+	Cooldown time.Duration
+	// Daily is the number of uses a key is allowed per day. Zero means
+	// unlimited.
+	Daily int
+	// Location is where days start for Daily. Defaults to UTC.
+	Location *time.Location
+	// Key groups the counted updates. Defaults to
+	// CombineKeys(KeyByRoute, KeyBySender). Updates with an empty key, such
+	// as channel posts, are not counted.
+	Key KeyFunc
+	// Storage keeps the counters. Defaults to a new MemoryStorage.
+	Storage Storage
+	// Message is a text/template executed with a QuotaExceeded and sent
+	// to users who exceed the quota. Defaults to DefaultQuotaMessage.
+	Message string
+	// Exempt, if not nil, exempts the updates for which it returns true.
+	Exempt func(ctx telebot.Context) bool
+}
+
+// DefaultQuotaMessage is the default QuotaConfig.Message.
+const DefaultQuotaMessage = "{{if .Daily}}Daily limit of {{.Limit}} reached, try again in {{.Wait}}." +
+	"{{else}}Please wait {{.Wait}} before trying again.{{end}}"
+
+// QuotaExceeded is the data the QuotaConfig.Message template is executed with.
+type QuotaExceeded struct {
+	// Wait is the time left until the key can be used again, rounded up
+	// to the second.
+	Wait time.Duration
+	// Daily is true if the daily quota is exhausted, false if the key is
+	// in cooldown.
+	Daily bool
+	// Used and Limit are today's uses and the daily quota.
+	Used, Limit int
+}
+
+// quotaCounter is the state of a key stored by Quota.
+type quotaCounter struct {
+	Last  int64 `json:"l"`
+	Day   int64 `json:"d"`
+	Count int   `json:"c"`
+}
+
+// Quota returns a middleware enforcing a cooldown and a daily quota, for
+// example to allow /generate once per 30 seconds and 20 times per day per
+// user:
+//
+//	r.With(router.Quota(router.QuotaConfig{
+//		Cooldown: 30 * time.Second,
+//		Daily:    20,
+//	})).HandleFuncText("/generate", generate)
+//
+// Updates exceeding the quota are marked as handled and answered with the
+// Message template.
+func Quota(cfg QuotaConfig) func(RouteHandler) RouteHandler {
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	if cfg.Key == nil {
+		cfg.Key = CombineKeys(KeyByRoute, KeyBySender)
+	}
+	if cfg.Storage == nil {
+		cfg.Storage = NewMemoryStorage()
+	}
+	if cfg.Message == "" {
+		cfg.Message = DefaultQuotaMessage
+	}
+	tmpl := template.Must(template.New("quota").Parse(cfg.Message))
+	ttl := cfg.Cooldown
+	if cfg.Daily > 0 {
+		ttl += 25 * time.Hour
+	}
+
+	return func(next RouteHandler) RouteHandler {
+		return HandlerFunc(func(ctx telebot.Context) error {
+			key := cfg.Key(ctx)
+			if key == "" || cfg.Exempt != nil && cfg.Exempt(ctx) {
+				return next.ServeContext(ctx)
+			}
+
+			var exceeded *QuotaExceeded
+			err := cfg.Storage.Update("quota:"+key, ttl, func(value []byte) ([]byte, error) {
+				var counter quotaCounter
+				if value != nil {
+					if err := json.Unmarshal(value, &counter); err != nil {
+						return nil, err
+					}
+				}
+
+				now := time.Now().In(cfg.Location)
+				today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, cfg.Location)
+				if counter.Day != today.Unix() {
+					counter.Day = today.Unix()
+					counter.Count = 0
+				}
+
+				switch {
+				case cfg.Daily > 0 && counter.Count >= cfg.Daily:
+					exceeded = &QuotaExceeded{Wait: today.AddDate(0, 0, 1).Sub(now), Daily: true}
+				case counter.Last != 0 && now.Sub(time.Unix(0, counter.Last)) < cfg.Cooldown:
+					exceeded = &QuotaExceeded{Wait: cfg.Cooldown - now.Sub(time.Unix(0, counter.Last))}
+				default:
+					counter.Last = now.UnixNano()
+					counter.Count++
+				}
+				if exceeded != nil {
+					exceeded.Used, exceeded.Limit = counter.Count, cfg.Daily
+					return nil, errUnchanged
+				}
+				return json.Marshal(counter)
+			})
+			if exceeded == nil {
+				if err != nil {
+					return err
+				}
+				return next.ServeContext(ctx)
+			}
+
+			MarkHandled(ctx)
+			if rem := exceeded.Wait % time.Second; rem != 0 {
+				exceeded.Wait += time.Second - rem
+			}
+			var text strings.Builder
+			if err := tmpl.Execute(&text, exceeded); err != nil {
+				return err
+			}
+			return SendUserMessage(ctx, text.String())
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package router
+
+import (
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/telebot.v4"
+	"testing"
+	"time"
+)
+
+func TestQuota(t *testing.T) {
+	t.Run("Cooldown", func(t *testing.T) {
+		mux := NewRouter()
+		mux.With(Quota(QuotaConfig{
+			Cooldown: 30 * time.Second,
+			Message:  "wait {{.Wait}}",
+		})).HandleFuncText("/generate", func(ctx tb.Context) error {
+			return ctx.Send("generated")
+		})
+
+		ctx := &mockContext{text: "/generate", chat: 1}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"generated"}, ctx.sent)
+
+		ctx = &mockContext{text: "/generate", chat: 1}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"reply:wait 30s"}, ctx.sent)
+	})
+
+	t.Run("Daily", func(t *testing.T) {
+		mux := NewRouter()
+		mux.With(Quota(QuotaConfig{Daily: 2})).HandleFuncText("/generate", func(ctx tb.Context) error {
+			return ctx.Send("generated")
+		})
+
+		var sent []string
+		for i := 0; i < 3; i++ {
+			ctx := &mockContext{text: "/generate", chat: 1}
+			assert.NoError(t, mux.ServeContext(ctx))
+			sent = append(sent, ctx.sent...)
+		}
+		assert.Equal(t, "generated", sent[1])
+		assert.Contains(t, sent[2], "reply:Daily limit of 2 reached")
+	})
+
+	t.Run("Empty Key", func(t *testing.T) {
+		mux := NewRouter()
+		mux.With(Quota(QuotaConfig{Daily: 1})).HandleFuncText("/generate", func(ctx tb.Context) error {
+			return ctx.Send("generated")
+		})
+
+		for i := 0; i < 3; i++ {
+			ctx := &mockContext{text: "/generate"}
+			assert.NoError(t, mux.ServeContext(ctx))
+			assert.Equal(t, []string{"generated"}, ctx.sent)
+		}
+	})
+}
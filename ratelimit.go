@@ -0,0 +1,147 @@
+package router
+
+import (
+	"encoding/json"
+	"gopkg.in/telebot.v4"
+	"math"
+	"strings"
+	"time"
+)
+
+// KeyByRoute groups updates by the name of the route handling them.
+func KeyByRoute(ctx telebot.Context) string {
+	route, _ := CurrentRoute(ctx)
+	return route.Name
+}
+
+// CombineKeys returns a KeyFunc joining the keys returned by fns, for example
+// CombineKeys(KeyByRoute, KeyBySender) to group updates per route and user.
+// The combined key is empty if one of the keys is.
+func CombineKeys(fns ...KeyFunc) KeyFunc {
+	return func(ctx telebot.Context) string {
+		keys := make([]string, len(fns))
+		for i, fn := range fns {
+			if keys[i] = fn(ctx); keys[i] == "" {
+				return ""
+			}
+		}
+		return strings.Join(keys, ":")
+	}
+}
+
+// RateLimitResponse decides how RateLimit responds to limited updates.
+type RateLimitResponse int
+
+const (
+	// RateLimitDrop silently drops limited updates.
+	RateLimitDrop RateLimitResponse = iota
+	// RateLimitWarnOnce sends the message once when a key becomes limited
+	// and drops further updates silently until it has tokens again.
+	RateLimitWarnOnce
+	// RateLimitAlert answers limited callbacks with the message as an alert
+	// and behaves like RateLimitWarnOnce for other updates.
+	RateLimitAlert
+)
+
+// RateLimitConfig configures the middleware returned by RateLimit.
+type RateLimitConfig struct {
+	// Rate is the number of updates per second a key is allowed on average.
+	// It must be positive.
+	Rate float64
+	// Burst is the number of updates a key is allowed at once. Defaults to 1.
+	Burst int
+	// Key groups the limited updates. Defaults to KeyBySender. Updates with
+	// an empty key, such as channel posts, are not limited.
+	Key KeyFunc
+	// Storage keeps the token buckets. Defaults to a new MemoryStorage.
+	Storage Storage
+	// Response decides how limited updates are answered.
+	Response RateLimitResponse
+	// Message is sent to limited users by RateLimitWarnOnce and RateLimitAlert.
+	// Defaults to "Too many requests, please slow down."
+	Message string
+	// Exempt, if not nil, exempts the updates for which it returns true,
+	// for example those sent by admins.
+	Exempt func(ctx telebot.Context) bool
+}
+
+// tokenBucket is the state of a key stored by RateLimit.
+type tokenBucket struct {
+	Tokens float64 `json:"t"`
+	Last   int64   `json:"l"`
+	Warned bool    `json:"w"`
+}
+
+// RateLimit returns a token bucket rate limiting middleware. Every key gets
+// Burst tokens, refilled at Rate tokens per second; an update takes one token
+// and is limited if none is left. Limited updates are marked as handled, so
+// they do not reach the NotFound handler. RateLimit panics if cfg.Rate is not
+// positive.
+func RateLimit(cfg RateLimitConfig) func(RouteHandler) RouteHandler {
+	if cfg.Rate <= 0 {
+		panic("router: RateLimit called with a non-positive rate")
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+	if cfg.Key == nil {
+		cfg.Key = KeyBySender
+	}
+	if cfg.Storage == nil {
+		cfg.Storage = NewMemoryStorage()
+	}
+	if cfg.Message == "" {
+		cfg.Message = "Too many requests, please slow down."
+	}
+	ttl := time.Second + time.Duration(float64(cfg.Burst)/cfg.Rate*float64(time.Second))
+
+	return func(next RouteHandler) RouteHandler {
+		return HandlerFunc(func(ctx telebot.Context) error {
+			key := cfg.Key(ctx)
+			if key == "" || cfg.Exempt != nil && cfg.Exempt(ctx) {
+				return next.ServeContext(ctx)
+			}
+
+			var allowed, warn bool
+			err := cfg.Storage.Update("ratelimit:"+key, ttl, func(value []byte) ([]byte, error) {
+				now := time.Now().UnixNano()
+				bucket := tokenBucket{Tokens: float64(cfg.Burst), Last: now}
+				if value != nil {
+					if err := json.Unmarshal(value, &bucket); err != nil {
+						return nil, err
+					}
+					elapsed := time.Duration(now - bucket.Last).Seconds()
+					bucket.Tokens = math.Min(float64(cfg.Burst), bucket.Tokens+elapsed*cfg.Rate)
+					bucket.Last = now
+				}
+
+				allowed = bucket.Tokens >= 1
+				if allowed {
+					bucket.Tokens--
+					bucket.Warned = false
+				} else if !bucket.Warned {
+					warn = true
+					bucket.Warned = true
+				}
+				return json.Marshal(bucket)
+			})
+			if err != nil {
+				return err
+			}
+			if allowed {
+				return next.ServeContext(ctx)
+			}
+
+			MarkHandled(ctx)
+			switch {
+			case cfg.Response == RateLimitAlert && ctx.Callback() != nil:
+				return ctx.RespondAlert(cfg.Message)
+			case cfg.Response != RateLimitDrop && warn:
+				return SendUserMessage(ctx, cfg.Message)
+			case ctx.Callback() != nil:
+				return ctx.Respond()
+			}
+			return nil
+		})
+	}
+}
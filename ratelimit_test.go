@@ -0,0 +1,73 @@
+package router
+
+import (
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/telebot.v4"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	t.Run("Rate Must Be Positive", func(t *testing.T) {
+		assert.Panics(t, func() { RateLimit(RateLimitConfig{}) })
+	})
+
+	t.Run("Warn Once", func(t *testing.T) {
+		mux := NewRouter()
+		mux.NotFound(func(ctx tb.Context) error {
+			return ctx.Send("not found")
+		})
+		mux.With(RateLimit(RateLimitConfig{
+			Rate:     0.001,
+			Burst:    2,
+			Response: RateLimitWarnOnce,
+			Message:  "slow down",
+		})).HandleFuncText("/start", func(ctx tb.Context) error {
+			return ctx.Send("hello")
+		})
+
+		var sent []string
+		for i := 0; i < 4; i++ {
+			ctx := &mockContext{text: "/start", chat: 1}
+			assert.NoError(t, mux.ServeContext(ctx))
+			sent = append(sent, ctx.sent...)
+		}
+		assert.Equal(t, []string{"hello", "hello", "reply:slow down"}, sent)
+
+		ctx := &mockContext{text: "/start", chat: 2}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"hello"}, ctx.sent)
+	})
+
+	t.Run("Exempt", func(t *testing.T) {
+		mux := NewRouter()
+		mux.With(RateLimit(RateLimitConfig{
+			Rate: 0.001,
+			Key:  CombineKeys(KeyByRoute, KeyBySender),
+			Exempt: func(ctx tb.Context) bool {
+				return ctx.Sender().ID == 42
+			},
+		})).HandleFuncText("/start", func(ctx tb.Context) error {
+			return ctx.Send("hello")
+		})
+
+		for i := 0; i < 3; i++ {
+			ctx := &mockContext{text: "/start", chat: 42}
+			assert.NoError(t, mux.ServeContext(ctx))
+			assert.Equal(t, []string{"hello"}, ctx.sent)
+		}
+	})
+
+	t.Run("Empty Key", func(t *testing.T) {
+		mux := NewRouter()
+		mux.With(RateLimit(RateLimitConfig{Rate: 0.001})).HandleFuncText("/start", func(ctx tb.Context) error {
+			return ctx.Send("hello")
+		})
+
+		// Updates without a sender do not share a bucket.
+		for i := 0; i < 3; i++ {
+			ctx := &mockContext{text: "/start"}
+			assert.NoError(t, mux.ServeContext(ctx))
+			assert.Equal(t, []string{"hello"}, ctx.sent)
+		}
+	})
+}
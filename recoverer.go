@@ -0,0 +1,96 @@
+package router
+
+import (
+	"fmt"
+	"gopkg.in/telebot.v4"
+	"runtime/debug"
+	"unicode/utf8"
+)
+
+// maxPanicReportLen limits the length of the report sent to the admin chat,
+// keeping it below Telegram's message size limit.
+const maxPanicReportLen = 3500
+
+// PanicError is the error produced by Recoverer from a recovered panic.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the goroutine at the time of the panic.
+	Stack []byte
+	// Route is the route whose handler panicked.
+	Route RouteInfo
+	// UpdateID is the ID of the update being processed.
+	UpdateID int
+	// Reported is true if the user was already shown the UserMessage of
+	// RecovererConfig, in which case error handlers should not notify
+	// the user again.
+	Reported bool
+	// ReportErr is the error sending the report to the AdminChat of
+	// RecovererConfig failed with, if any.
+	ReportErr error
+}
+
+// Error implements the error interface.
+func (e *PanicError) Error() string {
+	msg := fmt.Sprintf("router: panic in route %q (update %d): %v", e.Route.Pattern, e.UpdateID, e.Value)
+	if e.ReportErr != nil {
+		msg += fmt.Sprintf(" (report not sent: %v)", e.ReportErr)
+	}
+	return msg
+}
+
+// RecovererConfig configures the middleware returned by RecovererWithConfig.
+type RecovererConfig struct {
+	// UserMessage, if not empty, is shown to the user after a panic, and the
+	// PanicError is marked as Reported.
+	UserMessage string
+	// AdminChat, if not nil, receives a report with the stack trace of every panic.
+	AdminChat telebot.Recipient
+}
+
+// Recoverer is a middleware that recovers from panics in the handlers it wraps
+// and converts them into a *PanicError, which is passed to the error handler
+// of the route (see Mux.OnError).
+func Recoverer(next RouteHandler) RouteHandler {
+	return RecovererWithConfig(RecovererConfig{})(next)
+}
+
+// RecovererWithConfig returns a Recoverer middleware that additionally notifies
+// the user and an admin chat as configured by cfg.
+func RecovererWithConfig(cfg RecovererConfig) func(RouteHandler) RouteHandler {
+	return func(next RouteHandler) RouteHandler {
+		return HandlerFunc(func(ctx telebot.Context) (err error) {
+			defer func() {
+				rvr := recover()
+				if rvr == nil {
+					return
+				}
+
+				route, _ := CurrentRoute(ctx)
+				panicErr := &PanicError{
+					Value:    rvr,
+					Stack:    debug.Stack(),
+					Route:    route,
+					UpdateID: ctx.Update().ID,
+				}
+				if cfg.UserMessage != "" {
+					panicErr.Reported = SendUserMessage(ctx, cfg.UserMessage) == nil
+				}
+				if cfg.AdminChat != nil {
+					report := panicErr.Error() + "\n\n" + string(panicErr.Stack)
+					if len(report) > maxPanicReportLen {
+						// Cut at a rune boundary, so the report stays valid UTF-8.
+						n := maxPanicReportLen
+						for n > 0 && !utf8.RuneStart(report[n]) {
+							n--
+						}
+						report = report[:n]
+					}
+					_, panicErr.ReportErr = ctx.Bot().Send(cfg.AdminChat, report)
+				}
+				err = panicErr
+			}()
+			return next.ServeContext(ctx)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package router
+
+import (
+	"github.com/LZTD1/telebot-context-router/format"
+	"gopkg.in/telebot.v4"
+)
+
+// Outgoing is a request a handler makes through its context or bot, passed
+// through the response middlewares (see UseResponse) before it is performed.
+// Middlewares may change What and Opts to transform the request; To and
+// Message only describe its target.
+type Outgoing struct {
+	// Method is the name of the intercepted method, for example "Send",
+	// "Reply" or "Edit".
+	Method string
+	// To is the recipient of bot methods. It is nil for context methods,
+	// which respond to the chat of the update.
+	To telebot.Recipient
+	// Message is the message replied to or edited by bot methods. It is nil
+	// for context methods.
+	Message telebot.Editable
+	// What is the content of the request: a string, a telebot.Sendable or,
+	// for SendAlbum, a telebot.Album. EditCaption expects a string. A
+	// *format.Message has already been rendered to a string, with the
+	// options selecting its mode appended to Opts.
+	What interface{}
+	// Opts are the options of the request.
+	Opts []interface{}
+}
+
+// ResponseHandler performs an outgoing request on behalf of the handler
+// processing ctx.
+type ResponseHandler func(ctx telebot.Context, out *Outgoing) error
+
+// collectResponseMiddlewares gathers the response middlewares of the Mux
+// hierarchy like collectMiddlewares.
+func (m *Mux) collectResponseMiddlewares() []func(ResponseHandler) ResponseHandler {
+	var middlewares []func(ResponseHandler) ResponseHandler
+	for current := m; current != nil; current = current.parent {
+		middlewares = append(current.responseMiddlewares, middlewares...)
+	}
+	return middlewares
+}
+
+// UseResponse adds one or more response middlewares to the Mux's stack.
+// Response middlewares run for every message a handler sends, replies with or
+// edits through its context or bot (Send, SendAlbum, Reply, Edit, EditCaption,
+// EditOrSend and EditOrReply), after the handler's middlewares and handler
+// have been chosen. A middleware can transform the request by changing out or
+// passing a new Outgoing to next, veto it by returning without calling next,
+// or record it. Vetoed bot methods return a nil message, so returning an
+// error is usually the better way to veto.
+//
+// Like Use, response middlewares apply to the routes registered afterwards
+// on the Mux and its sub-routers, and to its fallback handlers.
+func (m *Mux) UseResponse(middlewares ...func(ResponseHandler) ResponseHandler) {
+	m.responseMiddlewares = append(m.responseMiddlewares, middlewares...)
+}
+
+// respond renders a *format.Message, passes out through the response
+// middlewares of the current route and performs it with perform.
+func (s *state) respond(ctx telebot.Context, out *Outgoing, perform func(out *Outgoing) error) error {
+	if msg, ok := out.What.(*format.Message); ok {
+		text, opts := msg.Render()
+		out.What, out.Opts = text, append(out.Opts[:len(out.Opts):len(out.Opts)], opts...)
+	}
+	// The end of the chain performs whatever request it is passed, so
+	// middlewares may replace out.
+	h := ResponseHandler(func(_ telebot.Context, out *Outgoing) error {
+		return perform(out)
+	})
+	for i := len(s.responses) - 1; i >= 0; i-- {
+		h = s.responses[i](h)
+	}
+	return h(ctx, out)
+}
@@ -0,0 +1,119 @@
+package router
+
+import (
+	"github.com/LZTD1/telebot-context-router/format"
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/telebot.v4"
+	"testing"
+)
+
+func TestUseResponse(t *testing.T) {
+	footer := func(next ResponseHandler) ResponseHandler {
+		return func(ctx tb.Context, out *Outgoing) error {
+			if text, ok := out.What.(string); ok {
+				out.What = text + " [footer]"
+			}
+			return next(ctx, out)
+		}
+	}
+
+	t.Run("Transform Per Group", func(t *testing.T) {
+		var recorded []interface{}
+		record := func(next ResponseHandler) ResponseHandler {
+			return func(ctx tb.Context, out *Outgoing) error {
+				recorded = append(recorded, out.What)
+				return next(ctx, out)
+			}
+		}
+
+		mux := NewRouter()
+		mux.HandleFuncText("/plain", func(ctx tb.Context) error {
+			return ctx.Send("plain")
+		})
+		mux.Group(func(r Router) {
+			r.UseResponse(footer, record)
+			r.HandleFuncText("/report", func(ctx tb.Context) error {
+				if err := ctx.Reply("report"); err != nil {
+					return err
+				}
+				_, err := ctx.Bot().Send(ctx.Recipient(), "copy")
+				return err
+			})
+		})
+
+		ctx := &mockContext{text: "/report"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"reply:report [footer]"}, ctx.sent)
+		assert.Equal(t, []interface{}{"report [footer]", "copy [footer]"}, recorded)
+
+		ctx = &mockContext{text: "/plain"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"plain"}, ctx.sent)
+	})
+
+	t.Run("Veto And Record", func(t *testing.T) {
+		var recorded []string
+		mux := NewRouter()
+		mux.UseResponse(func(next ResponseHandler) ResponseHandler {
+			return func(ctx tb.Context, out *Outgoing) error {
+				recorded = append(recorded, out.Method)
+				if out.What == "secret" {
+					return nil
+				}
+				return next(ctx, out)
+			}
+		})
+		mux.NotFound(func(ctx tb.Context) error {
+			return ctx.Send("not found")
+		})
+		mux.HandleFuncText("/start", func(ctx tb.Context) error {
+			return ctx.Send("secret")
+		})
+
+		ctx := &mockContext{text: "/start"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Empty(t, ctx.sent)
+
+		ctx = &mockContext{text: "/unknown"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"not found"}, ctx.sent)
+		assert.Equal(t, []string{"Send", "Send"}, recorded)
+	})
+
+	t.Run("Replace Outgoing", func(t *testing.T) {
+		mux := NewRouter()
+		mux.UseResponse(func(next ResponseHandler) ResponseHandler {
+			return func(ctx tb.Context, out *Outgoing) error {
+				return next(ctx, &Outgoing{Method: out.Method, What: "replaced"})
+			}
+		})
+		mux.HandleFuncText("/start", func(ctx tb.Context) error {
+			return ctx.Send("original", &tb.ReplyMarkup{})
+		})
+
+		ctx := &mockContext{text: "/start"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"replaced"}, ctx.sent)
+		assert.Empty(t, ctx.opts)
+	})
+
+	t.Run("Format Messages Are Rendered", func(t *testing.T) {
+		var recorded *Outgoing
+		mux := NewRouter()
+		mux.UseResponse(func(next ResponseHandler) ResponseHandler {
+			return func(ctx tb.Context, out *Outgoing) error {
+				recorded = out
+				return next(ctx, out)
+			}
+		})
+		mux.HandleFuncText("/start", func(ctx tb.Context) error {
+			return ctx.Send(format.New("Hello, ", format.Bold("<world>")))
+		})
+
+		ctx := &mockContext{text: "/start"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"Hello, <b>&lt;world&gt;</b>"}, ctx.sent)
+		assert.Equal(t, "Hello, <b>&lt;world&gt;</b>", recorded.What)
+		assert.Equal(t, []interface{}{tb.ModeHTML}, recorded.Opts)
+	})
+}
@@ -3,6 +3,7 @@ package router
 import (
 	"gopkg.in/telebot.v4"
 	"regexp"
+	"time"
 )
 
 // TypeHandling defines the type of incoming update to handle.
@@ -15,6 +16,64 @@ const (
 	TextHandle
 )
 
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	// Name is the name the route was registered under (see Mux.Named),
+	// or its pattern if it was not given a name.
+	Name string
+	// Pattern is the exact pattern or the source of the regular expression.
+	Pattern string
+	// Type is the type of update the route handles.
+	Type TypeHandling
+	// Regexp reports whether Pattern is a regular expression.
+	Regexp bool
+	// Limiter enforces the concurrency limits of the route (see Mux.Limit).
+	// It is nil if the route is not limited.
+	Limiter *Limiter
+}
+
+// MatchKind describes how an update was matched by the router.
+type MatchKind int
+
+const (
+	// MatchNone indicates that the update was not processed by any handler.
+	MatchNone MatchKind = iota
+	// MatchExact indicates that an exact route handled the update.
+	MatchExact
+	// MatchRegexp indicates that a regular expression route handled the update.
+	MatchRegexp
+	// MatchNotFound indicates that the NotFound handler was called.
+	MatchNotFound
+	// MatchForbidden indicates that the Forbidden handler was called.
+	MatchForbidden
+	// MatchUnsupported indicates that the UnsupportedUpdate handler was called.
+	MatchUnsupported
+)
+
+// IsFallback reports whether the update was passed to one of the fallback
+// handlers (NotFound, Forbidden or UnsupportedUpdate).
+func (k MatchKind) IsFallback() bool {
+	return k == MatchNotFound || k == MatchForbidden || k == MatchUnsupported
+}
+
+// Result describes how the router processed an update.
+type Result struct {
+	// Route is the route that handled or denied the update. It is zero when
+	// the NotFound or UnsupportedUpdate handler was called.
+	Route RouteInfo
+	// Match describes how the update was matched.
+	Match MatchKind
+	// Captures holds the submatches of a regular expression route, with the
+	// whole match at index 0.
+	Captures []string
+	// Handled reports whether the update was marked as handled.
+	Handled bool
+	// Actions is the number of outgoing API calls intercepted by the router.
+	Actions int
+	// Duration is the time spent processing the update.
+	Duration time.Duration
+}
+
 // RouteHandler defines the interface for handlers.
 type RouteHandler interface {
 	// ServeContext processes the incoming telebot context.
@@ -25,10 +84,22 @@ type RouteHandler interface {
 type Router interface {
 	// Use appends middleware to the router stack.
 	Use(middlewares ...func(RouteHandler) RouteHandler)
+	// UseResponse appends response middleware to the router stack.
+	UseResponse(middlewares ...func(ResponseHandler) ResponseHandler)
 	// With adds inline middleware for subsequent handlers.
 	With(middlewares ...func(RouteHandler) RouteHandler) Router
 	// Group creates a new router instance for route grouping.
 	Group(fn func(r Router)) Router
+	// Named creates a new router instance whose routes are registered under name.
+	Named(name string) Router
+	// Limit creates a new router instance whose routes share concurrency limits.
+	Limit(cfg LimitConfig) Router
+	// Normalize creates a new router instance whose text routes use a normalization pipeline.
+	Normalize(fns ...Normalizer) Router
+	// Scope creates a new router instance whose scope covers inputs starting with prefix.
+	Scope(prefix string, fn func(r Router)) Router
+	// ScopeRegexp creates a new router instance whose scope covers inputs matching pattern.
+	ScopeRegexp(pattern *regexp.Regexp, fn func(r Router)) Router
 
 	// Handle registers a handler for an exact pattern match.
 	Handle(pattern string, h RouteHandler, t TypeHandling)
@@ -39,6 +110,10 @@ type Router interface {
 	HandleText(pattern string, h RouteHandler)
 	// HandleFuncText registers a handler function for an exact text message match.
 	HandleFuncText(pattern string, fn telebot.HandlerFunc)
+	// HandleTextKey registers a handler for the translations of a catalog key.
+	HandleTextKey(key string, h RouteHandler)
+	// HandleFuncTextKey registers a handler function for the translations of a catalog key.
+	HandleFuncTextKey(key string, fn telebot.HandlerFunc)
 
 	// HandleCallback registers a handler for an exact callback data match.
 	HandleCallback(pattern string, h RouteHandler)
@@ -60,9 +135,20 @@ type Router interface {
 	// HandleFuncRegexpCallback registers a handler function for a regex callback data match.
 	HandleFuncRegexpCallback(pattern *regexp.Regexp, fn telebot.HandlerFunc)
 
+	// RegisterController registers the routes of a controller in a new group.
+	RegisterController(c Controller)
+
 	// NotFound sets the handler for routes not found.
 	NotFound(h telebot.HandlerFunc)
+	// Forbidden sets the handler for routes whose access was denied.
+	Forbidden(h telebot.HandlerFunc)
+	// UnsupportedUpdate sets the handler for updates that are neither text nor callbacks.
+	UnsupportedUpdate(h telebot.HandlerFunc)
+	// OnError sets the handler for errors returned by route handlers.
+	OnError(h ErrorHandler)
 
 	// ServeContext processes an incoming telebot update.
 	ServeContext(ctx telebot.Context) error
+	// Dispatch processes an incoming telebot update and reports how it was processed.
+	Dispatch(ctx telebot.Context) (Result, error)
 }
@@ -0,0 +1,324 @@
+package router
+
+import (
+	"github.com/LZTD1/telebot-context-router/format"
+	"gopkg.in/telebot.v4"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxMessageLength is the maximum length of a text message in UTF-16 code
+// units accepted by Telegram.
+const MaxMessageLength = 4096
+
+// SplitConfig configures the response middleware returned by SplitMessages.
+type SplitConfig struct {
+	// Limit is the maximum length of a part in UTF-16 code units, measured
+	// on the text including its markup. Defaults to MaxMessageLength.
+	Limit int
+	// ParseMode is assumed for messages sent without one, usually the
+	// ParseMode of the bot's settings.
+	ParseMode telebot.ParseMode
+}
+
+// SplitMessages returns a response middleware that splits text sent with
+// Send or Reply that is longer than the limit into several messages, sent in
+// order. Text is split on paragraph, line or word boundaries when possible.
+// With telebot.ModeHTML and telebot.ModeMarkdownV2, formatting entities open
+// at a split are closed at the end of the part and reopened at the start of
+// the next one, and tags, HTML character references, escapes and MarkdownV2
+// links are never cut. Reply markup is only attached to the last part. Text
+// sent with telebot.Entities is not split.
+//
+// Bot methods return the last message sent.
+func SplitMessages(cfg SplitConfig) func(ResponseHandler) ResponseHandler {
+	if cfg.Limit <= 0 {
+		cfg.Limit = MaxMessageLength
+	}
+
+	return func(next ResponseHandler) ResponseHandler {
+		return func(ctx telebot.Context, out *Outgoing) error {
+			text, ok := out.What.(string)
+			if !ok || (out.Method != "Send" && out.Method != "Reply") || format.UTF16Len(text) <= cfg.Limit {
+				return next(ctx, out)
+			}
+
+			mode := cfg.ParseMode
+			for _, opt := range out.Opts {
+				switch opt := opt.(type) {
+				case telebot.ParseMode:
+					mode = opt
+				case *telebot.SendOptions:
+					if opt != nil && opt.ParseMode != telebot.ModeDefault {
+						mode = opt.ParseMode
+					}
+				case telebot.Entities:
+					// Entity offsets refer to the whole text.
+					return next(ctx, out)
+				}
+			}
+
+			parts := splitText(text, mode, cfg.Limit)
+			for i, part := range parts {
+				partOut := *out
+				partOut.What = part
+				if i < len(parts)-1 {
+					partOut.Opts = withoutMarkup(out.Opts)
+				}
+				if err := next(ctx, &partOut); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// withoutMarkup returns a copy of opts without reply markup.
+func withoutMarkup(opts []interface{}) []interface{} {
+	result := make([]interface{}, 0, len(opts))
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case *telebot.ReplyMarkup:
+			continue
+		case *telebot.SendOptions:
+			if opt != nil && opt.ReplyMarkup != nil {
+				copied := *opt
+				copied.ReplyMarkup = nil
+				result = append(result, &copied)
+				continue
+			}
+		}
+		result = append(result, opt)
+	}
+	return result
+}
+
+// splitToken is an unsplittable piece of text.
+type splitToken struct {
+	text string
+	// open and close, if set, are the markup opening and closing the entity
+	// the token starts; pop is true if the token closes the current entity.
+	open, close string
+	pop         bool
+	// brk ranks the token as a split point: 0 for none, then spaces, line
+	// breaks and paragraph breaks.
+	brk int
+}
+
+// entity is an entity open at some point of the text.
+type entity struct {
+	open, close string
+}
+
+// splitText splits text into parts of at most limit UTF-16 code units,
+// keeping the entities of the parse mode intact.
+func splitText(text string, mode telebot.ParseMode, limit int) []string {
+	var tokens []splitToken
+	switch mode {
+	case telebot.ModeHTML:
+		tokens = tokenizeHTML(text)
+	case telebot.ModeMarkdownV2:
+		tokens = tokenizeMarkdownV2(text)
+	default:
+		tokens = tokenizePlain(text)
+	}
+
+	var parts []string
+	var stack []entity
+	for i := 0; i < len(tokens); {
+		prefix := openers(stack)
+		size := format.UTF16Len(prefix)
+		current := stack
+
+		// best is the split point chosen so far: breaks in the second half
+		// of the part are preferred, then higher ranked breaks, then later ones.
+		best, bestLate, bestBrk := -1, false, 0
+		var bestStack []entity
+		j := i
+		for ; j < len(tokens); j++ {
+			tok := tokens[j]
+			nextStack := apply(current, tok)
+			if j > i && size+format.UTF16Len(tok.text)+format.UTF16Len(closers(nextStack)) > limit {
+				break
+			}
+			size += format.UTF16Len(tok.text)
+			current = nextStack
+			late := size > limit/2
+			if tok.brk > 0 && (late && !bestLate || late == bestLate && tok.brk >= bestBrk) {
+				best, bestLate, bestBrk, bestStack = j, late, tok.brk, current
+			}
+		}
+
+		var b strings.Builder
+		b.WriteString(prefix)
+		if j == len(tokens) {
+			for _, tok := range tokens[i:] {
+				b.WriteString(tok.text)
+			}
+			parts = append(parts, b.String()+closers(current))
+			break
+		}
+
+		end, resume := j, j
+		if best >= 0 {
+			// The break token itself is whitespace and is dropped, along with
+			// the whitespace around it.
+			end, resume, current = best, best+1, bestStack
+			for resume < len(tokens) && tokens[resume].brk > 0 {
+				resume++
+			}
+		}
+		for end > i && tokens[end-1].brk > 0 {
+			end--
+		}
+		// Only whitespace precedes the break: drop it instead of sending an
+		// empty part.
+		if end > i {
+			for _, tok := range tokens[i:end] {
+				b.WriteString(tok.text)
+			}
+			parts = append(parts, b.String()+closers(current))
+		}
+		stack, i = current, resume
+	}
+	return parts
+}
+
+// apply returns the entities open after tok.
+func apply(stack []entity, tok splitToken) []entity {
+	switch {
+	case tok.pop && len(stack) > 0:
+		return stack[: len(stack)-1 : len(stack)-1]
+	case tok.open != "":
+		return append(stack[:len(stack):len(stack)], entity{open: tok.open, close: tok.close})
+	}
+	return stack
+}
+
+func openers(stack []entity) string {
+	var b strings.Builder
+	for _, e := range stack {
+		b.WriteString(e.open)
+	}
+	return b.String()
+}
+
+func closers(stack []entity) string {
+	var b strings.Builder
+	for i := len(stack) - 1; i >= 0; i-- {
+		b.WriteString(stack[i].close)
+	}
+	return b.String()
+}
+
+// runeToken returns the token for the first rune of s.
+func runeToken(s string, prev string) splitToken {
+	_, size := utf8.DecodeRuneInString(s)
+	tok := splitToken{text: s[:size]}
+	switch tok.text {
+	case " ":
+		tok.brk = 1
+	case "\n":
+		tok.brk = 2
+		if prev == "\n" {
+			tok.brk = 3
+		}
+	}
+	return tok
+}
+
+func tokenizePlain(text string) []splitToken {
+	var tokens []splitToken
+	prev := ""
+	for i := 0; i < len(text); {
+		tok := runeToken(text[i:], prev)
+		tokens = append(tokens, tok)
+		prev = tok.text
+		i += len(tok.text)
+	}
+	return tokens
+}
+
+func tokenizeHTML(text string) []splitToken {
+	var tokens []splitToken
+	prev := ""
+	for i := 0; i < len(text); {
+		var tok splitToken
+		switch rest := text[i:]; {
+		case rest[0] == '<' && strings.IndexByte(rest, '>') > 0:
+			tok.text = rest[:strings.IndexByte(rest, '>')+1]
+			if strings.HasPrefix(tok.text, "</") {
+				tok.pop = true
+			} else {
+				name := strings.Trim(tok.text, "<>/")
+				if k := strings.IndexAny(name, " \t\n"); k >= 0 {
+					name = name[:k]
+				}
+				tok.open, tok.close = tok.text, "</"+name+">"
+			}
+		case rest[0] == '&' && strings.IndexByte(rest, ';') > 0 && strings.IndexByte(rest, ';') < 10:
+			tok.text = rest[:strings.IndexByte(rest, ';')+1]
+		default:
+			tok = runeToken(rest, prev)
+		}
+		tokens = append(tokens, tok)
+		prev = tok.text
+		i += len(tok.text)
+	}
+	return tokens
+}
+
+func tokenizeMarkdownV2(text string) []splitToken {
+	var tokens []splitToken
+	var stack []entity
+	prev := ""
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		inCode := len(stack) > 0 && strings.HasPrefix(stack[len(stack)-1].close, "`")
+
+		var tok splitToken
+		marker := ""
+		switch {
+		case rest[0] == '\\' && len(rest) > 1:
+			_, size := utf8.DecodeRuneInString(rest[1:])
+			tok.text = rest[:1+size]
+		case strings.HasPrefix(rest, "```"):
+			marker = "```"
+		case rest[0] == '`':
+			marker = "`"
+		case inCode:
+		case strings.HasPrefix(rest, "||"), strings.HasPrefix(rest, "__"):
+			marker = rest[:2]
+		case rest[0] == '*', rest[0] == '_', rest[0] == '~':
+			marker = rest[:1]
+		case rest[0] == '[':
+			if end := strings.Index(rest, "]("); end > 0 {
+				if k := strings.IndexByte(rest[end:], ')'); k > 0 {
+					tok.text = rest[:end+k+1]
+				}
+			}
+		}
+
+		switch {
+		case marker != "" && len(stack) > 0 && stack[len(stack)-1].close == marker:
+			tok = splitToken{text: marker, pop: true}
+		case marker != "" && !inCode:
+			tok = splitToken{text: marker, open: marker, close: marker}
+			if marker == "```" {
+				// The language line belongs to the opening fence.
+				if k := strings.IndexByte(rest, '\n'); k >= 0 {
+					tok.text, tok.open = rest[:k+1], rest[:k+1]
+				}
+			}
+		case tok.text == "":
+			tok = runeToken(rest, prev)
+		}
+
+		stack = apply(stack, tok)
+		tokens = append(tokens, tok)
+		prev = tok.text
+		i += len(tok.text)
+	}
+	return tokens
+}
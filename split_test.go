@@ -0,0 +1,51 @@
+package router
+
+import (
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/telebot.v4"
+	"strings"
+	"testing"
+)
+
+func TestSplitMessages(t *testing.T) {
+	t.Run("Paragraphs And Markup", func(t *testing.T) {
+		var parts []*Outgoing
+		mux := NewRouter()
+		mux.UseResponse(SplitMessages(SplitConfig{Limit: 20}), func(next ResponseHandler) ResponseHandler {
+			return func(ctx tb.Context, out *Outgoing) error {
+				parts = append(parts, out)
+				return next(ctx, out)
+			}
+		})
+		markup := &tb.ReplyMarkup{}
+		mux.HandleFuncText("/report", func(ctx tb.Context) error {
+			return ctx.Send("first paragraph\n\nsecond one\nand more words", markup)
+		})
+
+		ctx := &mockContext{text: "/report"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"first paragraph", "second one", "and more words"}, ctx.sent)
+		assert.Empty(t, parts[0].Opts)
+		assert.Empty(t, parts[1].Opts)
+		assert.Equal(t, []interface{}{markup}, parts[2].Opts)
+	})
+
+	t.Run("Entities", func(t *testing.T) {
+		tests := []struct {
+			mode  tb.ParseMode
+			limit int
+			text  string
+			want  []string
+		}{
+			{tb.ModeHTML, 20, "<b>bold &amp; long text</b>", []string{"<b>bold &amp;</b>", "<b>long text</b>"}},
+			{tb.ModeMarkdownV2, 14, "*bold \\* long text*", []string{"*bold \\**", "*long text*"}},
+			{tb.ModeMarkdownV2, 24, "```go\nfmt.Println()\nreturn\n```", []string{"```go\nfmt.Println()```", "```go\nreturn\n```"}},
+			{tb.ModeDefault, 4, "😀😀😀", []string{"😀😀", "😀"}},
+			{tb.ModeDefault, 20, " " + strings.Repeat("a", 50), []string{strings.Repeat("a", 20), strings.Repeat("a", 20), strings.Repeat("a", 10)}},
+			{tb.ModeHTML, 10, "<b>a    b</b>", []string{"<b>a</b>", "<b>b</b>"}},
+		}
+		for _, tt := range tests {
+			assert.Equal(t, tt.want, splitText(tt.text, tt.mode, tt.limit))
+		}
+	})
+}
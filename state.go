@@ -0,0 +1,185 @@
+package router
+
+import (
+	"context"
+	"gopkg.in/telebot.v4"
+	"sync"
+	"time"
+)
+
+// stateKey is the context key under which wrappedContext exposes the state of
+// the update, see wrappedContext.Get.
+const stateKey = "telebot-context-router.state"
+
+// HandledPolicy decides whether a call of the named API method (for example
+// "Send", "Notify" or "Raw") made while processing an update counts as having
+// handled the update. The names are those of the telebot.Context and
+// telebot.API methods intercepted by the router.
+type HandledPolicy func(method string) bool
+
+// HandledByAll is the default HandledPolicy: every intercepted call counts.
+func HandledByAll(method string) bool {
+	return true
+}
+
+// HandledBy returns a HandledPolicy under which only the given methods count.
+func HandledBy(methods ...string) HandledPolicy {
+	set := make(map[string]struct{}, len(methods))
+	for _, method := range methods {
+		set[method] = struct{}{}
+	}
+	return func(method string) bool {
+		_, ok := set[method]
+		return ok
+	}
+}
+
+// HandledExcept returns a HandledPolicy under which every method except the
+// given ones counts.
+func HandledExcept(methods ...string) HandledPolicy {
+	only := HandledBy(methods...)
+	return func(method string) bool {
+		return !only(method)
+	}
+}
+
+// state tracks a single update while the router processes it. It is shared by
+// the wrapped context and the wrapped bot of the update.
+type state struct {
+	mu        sync.Mutex
+	settings  *settings
+	goCtx     context.Context
+	policy    HandledPolicy
+	route     RouteInfo
+	responses []func(ResponseHandler) ResponseHandler
+	handled   bool
+	denied    bool
+	actions   int
+}
+
+// mark records a call of the named method, marking the update as handled if
+// the policy allows it.
+func (s *state) mark(method string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actions++
+	if s.policy == nil || s.policy(method) {
+		s.handled = true
+	}
+}
+
+func (s *state) actionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.actions
+}
+
+func (s *state) wasHandled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handled
+}
+
+func (s *state) setHandled(handled bool) {
+	s.mu.Lock()
+	s.handled = handled
+	s.mu.Unlock()
+}
+
+func (s *state) goContext() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.goCtx
+}
+
+func (s *state) setGoContext(goCtx context.Context) {
+	s.mu.Lock()
+	s.goCtx = goCtx
+	s.mu.Unlock()
+}
+
+func (s *state) deny() {
+	s.mu.Lock()
+	s.denied = true
+	s.mu.Unlock()
+}
+
+func (s *state) wasDenied() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.denied
+}
+
+// stateOf returns the state of the update ctx belongs to, or nil if ctx was
+// not passed through the router. Contexts wrapping the router's context are
+// supported as long as they delegate Get.
+func stateOf(ctx telebot.Context) *state {
+	if w, ok := ctx.(*wrappedContext); ok {
+		return w.state
+	}
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Get(stateKey).(*state)
+	return s
+}
+
+// MarkHandled marks the update ctx belongs to as handled, so the router does
+// not fall back to the NotFound handler or pass it to the next route. It is a
+// no-op if ctx was not passed through the router.
+func MarkHandled(ctx telebot.Context) {
+	if s := stateOf(ctx); s != nil {
+		s.setHandled(true)
+	}
+}
+
+// WasHandled reports whether the update ctx belongs to has been handled,
+// either by an API call counted by the HandledPolicy or by MarkHandled.
+func WasHandled(ctx telebot.Context) bool {
+	if s := stateOf(ctx); s != nil {
+		return s.wasHandled()
+	}
+	return false
+}
+
+// CurrentRoute returns the route whose handler is processing ctx. The second
+// result is false if ctx was not passed through the router.
+func CurrentRoute(ctx telebot.Context) (RouteInfo, bool) {
+	if s := stateOf(ctx); s != nil {
+		return s.route, true
+	}
+	return RouteInfo{}, false
+}
+
+// GoContext returns the context.Context of the update ctx belongs to. It is
+// derived from the base context of the router (see WithBaseContext), carries
+// the deadline configured with WithHandlerTimeout or Timeout and is cancelled
+// when the router has finished processing the update. If ctx was not passed
+// through the router, context.Background() is returned.
+func GoContext(ctx telebot.Context) context.Context {
+	if s := stateOf(ctx); s != nil && s.goContext() != nil {
+		return s.goContext()
+	}
+	return context.Background()
+}
+
+// Timeout is a middleware that sets a deadline of d on the context returned
+// by GoContext for the handlers it wraps. Handlers are expected to observe
+// the deadline; Timeout does not interrupt them.
+func Timeout(d time.Duration) func(RouteHandler) RouteHandler {
+	return func(next RouteHandler) RouteHandler {
+		return HandlerFunc(func(ctx telebot.Context) error {
+			s := stateOf(ctx)
+			if s == nil {
+				return next.ServeContext(ctx)
+			}
+			parent := GoContext(ctx)
+			goCtx, cancel := context.WithTimeout(parent, d)
+			defer cancel()
+
+			s.setGoContext(goCtx)
+			defer s.setGoContext(parent)
+			return next.ServeContext(ctx)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package router
+
+import (
+	"sync"
+	"time"
+)
+
+// Storage is a key-value store used by stateful middlewares, such as
+// RateLimit, to keep their state. Implementations backed by a shared store
+// (for example Redis) let several bot instances share the state.
+// Implementations must be safe for concurrent use.
+type Storage interface {
+	// Get returns the value stored under key, or nil if there is none.
+	Get(key string) ([]byte, error)
+	// Update atomically passes the value stored under key (nil if there is
+	// none) to fn and stores the value fn returns, expiring after ttl.
+	// If fn returns an error, the stored value is left unchanged and Update
+	// returns that error.
+	Update(key string, ttl time.Duration, fn func(value []byte) ([]byte, error)) error
+	// Delete removes the value stored under key.
+	Delete(key string) error
+}
+
+// memoryItem is a value stored in a MemoryStorage.
+type memoryItem struct {
+	value   []byte
+	expires time.Time
+}
+
+// MemoryStorage is an in-process Storage. Expired values are removed lazily.
+type MemoryStorage struct {
+	mu     sync.Mutex
+	items  map[string]memoryItem
+	writes int
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		items: make(map[string]memoryItem),
+	}
+}
+
+// get returns the unexpired value stored under key. s.mu must be held.
+func (s *MemoryStorage) get(key string, now time.Time) []byte {
+	item, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	if now.After(item.expires) {
+		delete(s.items, key)
+		return nil
+	}
+	return item.value
+}
+
+// Get implements Storage.
+func (s *MemoryStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(key, time.Now()), nil
+}
+
+// Update implements Storage.
+func (s *MemoryStorage) Update(key string, ttl time.Duration, fn func(value []byte) ([]byte, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	value, err := fn(s.get(key, now))
+	if err != nil {
+		return err
+	}
+	s.items[key] = memoryItem{value: value, expires: now.Add(ttl)}
+
+	// Sweep expired values from time to time, so keys that are never
+	// accessed again do not accumulate.
+	s.writes++
+	if s.writes%1024 == 0 {
+		for k, item := range s.items {
+			if now.After(item.expires) {
+				delete(s.items, k)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete implements Storage.
+func (s *MemoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, key)
+	return nil
+}
@@ -0,0 +1,109 @@
+package router
+
+// routeTable is an immutable snapshot of the routes registered on a Mux.
+// Registration and removal build a modified copy of the table and swap it in
+// atomically, so updates being dispatched keep using the snapshot they loaded.
+type routeTable struct {
+	exactText     map[string]exactEntry
+	exactCallback map[string]exactEntry
+	regexText     []regexEntry
+	regexCallback []regexEntry
+}
+
+// newRouteTable returns an empty route table.
+func newRouteTable() *routeTable {
+	return &routeTable{
+		exactText:     make(map[string]exactEntry),
+		exactCallback: make(map[string]exactEntry),
+		regexText:     make([]regexEntry, 0),
+		regexCallback: make([]regexEntry, 0),
+	}
+}
+
+// clone returns a copy of t that can be modified without affecting t.
+func (t *routeTable) clone() *routeTable {
+	nt := &routeTable{
+		exactText:     make(map[string]exactEntry, len(t.exactText)),
+		exactCallback: make(map[string]exactEntry, len(t.exactCallback)),
+		regexText:     append(make([]regexEntry, 0, len(t.regexText)), t.regexText...),
+		regexCallback: append(make([]regexEntry, 0, len(t.regexCallback)), t.regexCallback...),
+	}
+	for pattern, entry := range t.exactText {
+		nt.exactText[pattern] = entry
+	}
+	for pattern, entry := range t.exactCallback {
+		nt.exactCallback[pattern] = entry
+	}
+	return nt
+}
+
+// exact returns the exact routes for the given type of update.
+func (t *routeTable) exact(typ TypeHandling) map[string]exactEntry {
+	if typ == CallbackHandle {
+		return t.exactCallback
+	}
+	return t.exactText
+}
+
+// regex returns the regular expression routes for the given type of update.
+func (t *routeTable) regex(typ TypeHandling) []regexEntry {
+	if typ == CallbackHandle {
+		return t.regexCallback
+	}
+	return t.regexText
+}
+
+// setRegex replaces the regular expression routes for the given type of update.
+func (t *routeTable) setRegex(typ TypeHandling, entries []regexEntry) {
+	if typ == CallbackHandle {
+		t.regexCallback = entries
+	} else {
+		t.regexText = entries
+	}
+}
+
+// remove deletes the routes of the given type whose pattern equals pattern
+// and reports whether any route was deleted.
+func (t *routeTable) remove(pattern string, typ TypeHandling) bool {
+	removed := false
+	exact := t.exact(typ)
+	for key, entry := range exact {
+		if entry.info.Pattern == pattern {
+			delete(exact, key)
+			removed = true
+		}
+	}
+
+	entries := t.regex(typ)
+	kept := make([]regexEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.info.Pattern == pattern {
+			removed = true
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	t.setRegex(typ, kept)
+	return removed
+}
+
+// removeConfig deletes the routes loaded from a configuration file on m.
+func (t *routeTable) removeConfig(m *Mux) {
+	for _, exact := range []map[string]exactEntry{t.exactText, t.exactCallback} {
+		for pattern, entry := range exact {
+			if entry.fromConfig && entry.mux == m {
+				delete(exact, pattern)
+			}
+		}
+	}
+	for _, typ := range []TypeHandling{TextHandle, CallbackHandle} {
+		entries := t.regex(typ)
+		kept := make([]regexEntry, 0, len(entries))
+		for _, entry := range entries {
+			if !(entry.fromConfig && entry.mux == m) {
+				kept = append(kept, entry)
+			}
+		}
+		t.setRegex(typ, kept)
+	}
+}
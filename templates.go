@@ -0,0 +1,234 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"github.com/LZTD1/telebot-context-router/format"
+	"gopkg.in/telebot.v4"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// ErrNoTemplates is returned by Render when the router has no templates.
+var ErrNoTemplates = errors.New("router: no templates")
+
+// TemplateConfig configures the templates created by NewTemplates.
+type TemplateConfig struct {
+	// FS holds a directory per locale, named after it (for example "en" or
+	// "pt-br"), with text/template files named after the template and ending
+	// in ".tmpl".
+	FS fs.FS
+	// Dir is used instead of FS if FS is nil.
+	Dir string
+	// Funcs are added to the functions available to the templates.
+	Funcs template.FuncMap
+	// ParseMode is the parse mode Render sends the text with. Data is not
+	// escaped automatically, see Render.
+	ParseMode telebot.ParseMode
+	// Reload parses the templates again on every Render, so changes are
+	// picked up without restarting the bot. Meant for development.
+	Reload bool
+}
+
+// Templates are sets of text templates per locale, see Render.
+type Templates struct {
+	cfg TemplateConfig
+
+	mu      sync.Mutex
+	locales map[string]*template.Template
+}
+
+// NewTemplates parses the templates described by cfg.
+func NewTemplates(cfg TemplateConfig) (*Templates, error) {
+	if cfg.FS == nil {
+		cfg.FS = os.DirFS(cfg.Dir)
+	}
+	t := &Templates{cfg: cfg}
+	locales, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+	t.locales = locales
+	return t, nil
+}
+
+// WithTemplates sets the templates used by Render.
+func WithTemplates(t *Templates) Option {
+	return func(s *settings) {
+		s.templates = t
+	}
+}
+
+// keyboard collects the inline keyboard defined by a template execution.
+type keyboard struct {
+	rows [][]telebot.InlineButton
+}
+
+func (k *keyboard) add(button telebot.InlineButton) string {
+	if len(k.rows) == 0 {
+		k.rows = append(k.rows, nil)
+	}
+	k.rows[len(k.rows)-1] = append(k.rows[len(k.rows)-1], button)
+	return ""
+}
+
+// funcs returns the keyboard functions available to templates:
+//
+//	{{button "Pay" "pay:42"}}          adds a callback button to the current row
+//	{{url "Docs" "https://example.com"}} adds a URL button to the current row
+//	{{row}}                            starts a new row
+func (k *keyboard) funcs() template.FuncMap {
+	return template.FuncMap{
+		"button": func(text, data string) string {
+			return k.add(telebot.InlineButton{Text: text, Data: data})
+		},
+		"url": func(text, url string) string {
+			return k.add(telebot.InlineButton{Text: text, URL: url})
+		},
+		"row": func() string {
+			k.rows = append(k.rows, nil)
+			return ""
+		},
+	}
+}
+
+// escapeFuncs are the functions escaping data for the parse mode of the
+// templates:
+//
+//	{{html .Name}} escapes for telebot.ModeHTML
+//	{{md .Name}}   escapes for telebot.ModeMarkdownV2
+var escapeFuncs = template.FuncMap{
+	"html": func(args ...interface{}) string {
+		return format.EscapeHTML(fmt.Sprint(args...))
+	},
+	"md": func(args ...interface{}) string {
+		return format.EscapeMarkdownV2(fmt.Sprint(args...))
+	},
+}
+
+// parse parses the template set of every locale directory.
+func (t *Templates) parse() (map[string]*template.Template, error) {
+	entries, err := fs.ReadDir(t.cfg.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("router: templates: %w", err)
+	}
+	locales := make(map[string]*template.Template)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		locale := entry.Name()
+		tmpl := template.New(locale).Funcs(escapeFuncs).Funcs((&keyboard{}).funcs()).Funcs(t.cfg.Funcs)
+		matches, err := fs.Glob(t.cfg.FS, locale+"/*.tmpl")
+		if err != nil {
+			return nil, fmt.Errorf("router: templates: %w", err)
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		if tmpl, err = tmpl.ParseFS(t.cfg.FS, matches...); err != nil {
+			return nil, fmt.Errorf("router: templates: %w", err)
+		}
+		locales[locale] = tmpl
+	}
+	return locales, nil
+}
+
+// lookup returns the template set of the first locale having the template
+// name, and the template's name in it.
+func (t *Templates) lookup(locales []string, name string) (*template.Template, string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cfg.Reload {
+		parsed, err := t.parse()
+		if err != nil {
+			return nil, "", err
+		}
+		t.locales = parsed
+	}
+	for _, locale := range locales {
+		set := t.locales[strings.ToLower(locale)]
+		if set == nil {
+			set = t.locales[locale]
+		}
+		if set == nil {
+			continue
+		}
+		for _, candidate := range []string{name + ".tmpl", name} {
+			if set.Lookup(candidate) != nil {
+				return set, candidate, nil
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("router: template %q not found for locales %v", name, locales)
+}
+
+// execute executes the template name of the first of locales having it and
+// returns its text and the inline keyboard it defines, if any.
+func (t *Templates) execute(locales []string, name string, data interface{}) (string, *telebot.ReplyMarkup, error) {
+	set, name, err := t.lookup(locales, name)
+	if err != nil {
+		return "", nil, err
+	}
+	set, err = set.Clone()
+	if err != nil {
+		return "", nil, err
+	}
+
+	kb := &keyboard{}
+	var text strings.Builder
+	if err := set.Funcs(kb.funcs()).ExecuteTemplate(&text, name, data); err != nil {
+		return "", nil, err
+	}
+
+	var markup *telebot.ReplyMarkup
+	for _, row := range kb.rows {
+		if len(row) == 0 {
+			continue
+		}
+		if markup == nil {
+			markup = &telebot.ReplyMarkup{}
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+	}
+	return strings.TrimSpace(text.String()), markup, nil
+}
+
+// Render executes the template name for the locale of ctx (see Locale) with
+// data and sends the result. Templates missing from a regional locale, such
+// as "pt-br", are looked up in its language ("pt") and then in the default
+// locale. Inline keyboards can be defined in the templates with the button,
+// url and row functions:
+//
+//	Order #{{.ID}} created.
+//	{{button "Pay" (printf "pay:%d" .ID)}}{{button "Cancel" (printf "cancel:%d" .ID)}}
+//	{{row}}{{url "Help" "https://example.com/help"}}
+//
+// Data inserted into templates sent with a parse mode must be escaped with
+// the html or md function, such as {{html .Customer}} for telebot.ModeHTML.
+//
+// Render returns ErrNoTemplates if no templates were set with WithTemplates.
+func Render(ctx telebot.Context, name string, data interface{}) error {
+	st := stateOf(ctx)
+	if st == nil || st.settings == nil || st.settings.templates == nil {
+		return ErrNoTemplates
+	}
+	t := st.settings.templates
+
+	text, markup, err := t.execute(localeChain(ctx), name, data)
+	if err != nil {
+		return err
+	}
+	var opts []interface{}
+	if t.cfg.ParseMode != telebot.ModeDefault {
+		opts = append(opts, t.cfg.ParseMode)
+	}
+	if markup != nil {
+		opts = append(opts, markup)
+	}
+	return ctx.Send(text, opts...)
+}
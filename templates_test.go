@@ -0,0 +1,71 @@
+package router
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tb "gopkg.in/telebot.v4"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRender(t *testing.T) {
+	templates, err := NewTemplates(TemplateConfig{
+		FS: fstest.MapFS{
+			"en/order_created.tmpl": {Data: []byte("Order #{{.}} created.\n{{button \"Pay\" (printf \"pay:%d\" .)}}{{row}}{{url \"Help\" \"https://example.com\"}}")},
+			"en/bye.tmpl":           {Data: []byte("Bye!")},
+			"en/hello.tmpl":         {Data: []byte("Hello, <b>{{html .}}</b>!")},
+			"ru/order_created.tmpl": {Data: []byte("Заказ #{{.}} создан.")},
+		},
+		ParseMode: tb.ModeHTML,
+	})
+	require.NoError(t, err)
+
+	mux := NewRouter(WithTemplates(templates))
+	mux.HandleFuncText("/order", func(ctx tb.Context) error {
+		return Render(ctx, "order_created", 7)
+	})
+	mux.HandleFuncText("/bye", func(ctx tb.Context) error {
+		return Render(ctx, "bye", nil)
+	})
+	mux.HandleFuncText("/hello", func(ctx tb.Context) error {
+		return Render(ctx, "hello", "<Tom & Jerry>")
+	})
+	mux.HandleFuncText("/en", func(ctx tb.Context) error {
+		if err := SetLocale(ctx, "en"); err != nil {
+			return err
+		}
+		return Render(ctx, "order_created", 8)
+	})
+
+	t.Run("Keyboard", func(t *testing.T) {
+		ctx := &mockContext{text: "/order", chat: 1}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"Order #7 created."}, ctx.sent)
+		assert.Equal(t, []interface{}{tb.ModeHTML, &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{
+			{{Text: "Pay", Data: "pay:7"}},
+			{{Text: "Help", URL: "https://example.com"}},
+		}}}, ctx.opts)
+	})
+
+	t.Run("Escape", func(t *testing.T) {
+		ctx := &mockContext{text: "/hello", chat: 3}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"Hello, <b>&lt;Tom &amp; Jerry&gt;</b>!"}, ctx.sent)
+	})
+
+	t.Run("Locales", func(t *testing.T) {
+		ctx := &mockContext{text: "/order", chat: 2, language: "ru"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"Заказ #7 создан."}, ctx.sent)
+
+		ctx = &mockContext{text: "/bye", chat: 2, language: "ru-RU"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"Bye!"}, ctx.sent)
+
+		ctx = &mockContext{text: "/en", chat: 2, language: "ru"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		ctx = &mockContext{text: "/order", chat: 2, language: "ru"}
+		assert.NoError(t, mux.ServeContext(ctx))
+		assert.Equal(t, []string{"Order #7 created."}, ctx.sent)
+	})
+}
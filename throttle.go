@@ -0,0 +1,193 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"gopkg.in/telebot.v4"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ThrottleConfig configures outgoing API throttling, see WithThrottle.
+// Negative values disable the corresponding limit.
+type ThrottleConfig struct {
+	// Global is the number of messages per second sent to all chats.
+	// Defaults to 30.
+	Global int
+	// PerChat is the minimum interval between two messages sent to the
+	// same chat. Defaults to 1 second.
+	PerChat time.Duration
+	// GroupPerMinute is the number of messages per minute sent to the same
+	// group or channel. Defaults to 20.
+	GroupPerMinute int
+	// Retries is how many times a request failing with a telebot.FloodError
+	// is retried after waiting for its RetryAfter. Defaults to 3.
+	Retries int
+}
+
+// WithThrottle makes the bot passed to handlers (and the context methods
+// sending through it) wait for Telegram's rate limits before sending or
+// editing messages, instead of failing with "Too Many Requests". All updates
+// share one scheduler. Requests failing with a telebot.FloodError anyway are
+// retried after the RetryAfter the API asked for.
+//
+// Waiting stops when the handler's GoContext is done, so WithHandlerTimeout
+// bounds how long a handler may be delayed.
+func WithThrottle(cfg ThrottleConfig) Option {
+	if cfg.Global == 0 {
+		cfg.Global = 30
+	}
+	if cfg.PerChat == 0 {
+		cfg.PerChat = time.Second
+	}
+	if cfg.GroupPerMinute == 0 {
+		cfg.GroupPerMinute = 20
+	}
+	if cfg.Retries == 0 {
+		cfg.Retries = 3
+	}
+	return func(s *settings) {
+		s.throttle = &throttler{cfg: cfg, chats: make(map[int64]*chatSlots)}
+	}
+}
+
+// chatSlots is the scheduling state of a chat.
+type chatSlots struct {
+	next   time.Time
+	recent []time.Time // messages sent to a group in the last minute
+}
+
+// throttler schedules outgoing requests so they respect a ThrottleConfig.
+type throttler struct {
+	cfg   ThrottleConfig
+	mu    sync.Mutex
+	next  time.Time
+	chats map[int64]*chatSlots
+	count int
+}
+
+// reserveChat reserves the next slot of chat and returns when it starts.
+func (t *throttler) reserveChat(chat int64) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if t.count++; t.count%1024 == 0 {
+		for id, c := range t.chats {
+			if c.next.Before(now) && (len(c.recent) == 0 || now.Sub(c.recent[len(c.recent)-1]) > time.Minute) {
+				delete(t.chats, id)
+			}
+		}
+	}
+
+	c := t.chats[chat]
+	if c == nil {
+		c = &chatSlots{}
+		t.chats[chat] = c
+	}
+	at := now
+	if c.next.After(at) {
+		at = c.next
+	}
+	if chat < 0 && t.cfg.GroupPerMinute > 0 {
+		for len(c.recent) > 0 && at.Sub(c.recent[0]) >= time.Minute {
+			c.recent = c.recent[1:]
+		}
+		if len(c.recent) >= t.cfg.GroupPerMinute {
+			at = c.recent[len(c.recent)-t.cfg.GroupPerMinute].Add(time.Minute)
+		}
+		c.recent = append(c.recent, at)
+	}
+	if t.cfg.PerChat > 0 {
+		c.next = at.Add(t.cfg.PerChat)
+	}
+	return at
+}
+
+// reserveGlobal reserves the next global slot and returns when it starts.
+func (t *throttler) reserveGlobal() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	at := time.Now()
+	if t.next.After(at) {
+		at = t.next
+	}
+	if t.cfg.Global > 0 {
+		t.next = at.Add(time.Second / time.Duration(t.cfg.Global))
+	}
+	return at
+}
+
+// delay pushes the next slot of chat, or the global one if chat is 0, to
+// after d.
+func (t *throttler) delay(chat int64, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	next := &t.next
+	if c := t.chats[chat]; chat != 0 && c != nil {
+		next = &c.next
+	}
+	if at := time.Now().Add(d); at.After(*next) {
+		*next = at
+	}
+}
+
+// do calls fn, which sends a request to chat (0 if unknown), once the
+// limits allow it, retrying it on flood errors.
+func (t *throttler) do(ctx context.Context, chat int64, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		if chat != 0 {
+			if err := sleepUntil(ctx, t.reserveChat(chat)); err != nil {
+				return err
+			}
+		}
+		if err := sleepUntil(ctx, t.reserveGlobal()); err != nil {
+			return err
+		}
+
+		err := fn()
+		var flood telebot.FloodError
+		if !errors.As(err, &flood) || attempt >= t.cfg.Retries {
+			return err
+		}
+		t.delay(chat, time.Duration(flood.RetryAfter)*time.Second)
+	}
+}
+
+// sleepUntil waits until at or until ctx is done.
+func sleepUntil(ctx context.Context, at time.Time) error {
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// recipientID returns the chat ID of to, or 0 if it is not numeric, for
+// example a channel username.
+func recipientID(to telebot.Recipient) int64 {
+	if to == nil {
+		return 0
+	}
+	id, _ := strconv.ParseInt(to.Recipient(), 10, 64)
+	return id
+}
+
+// editableChat returns the chat ID of the message msg refers to.
+func editableChat(msg telebot.Editable) int64 {
+	if msg == nil {
+		return 0
+	}
+	_, chat := msg.MessageSig()
+	return chat
+}
@@ -0,0 +1,52 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/telebot.v4"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	t.Run("Per Chat", func(t *testing.T) {
+		mux := NewRouter(WithThrottle(ThrottleConfig{Global: -1, PerChat: 30 * time.Millisecond}))
+		mux.HandleFuncText("/start", func(ctx tb.Context) error {
+			return ctx.Send("hello")
+		})
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, mux.ServeContext(&mockContext{text: "/start", chat: 1}))
+		}
+		assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+	})
+
+	t.Run("Chats Are Independent", func(t *testing.T) {
+		th := &throttler{cfg: ThrottleConfig{PerChat: time.Minute}, chats: make(map[int64]*chatSlots)}
+		first := th.reserveChat(1)
+		assert.Equal(t, first.Add(time.Minute), th.reserveChat(1))
+		assert.False(t, th.reserveChat(2).After(time.Now()))
+	})
+
+	t.Run("Group Per Minute", func(t *testing.T) {
+		th := &throttler{cfg: ThrottleConfig{GroupPerMinute: 2}, chats: make(map[int64]*chatSlots)}
+		first := th.reserveChat(-1)
+		th.reserveChat(-1)
+		assert.Equal(t, first.Add(time.Minute), th.reserveChat(-1))
+	})
+
+	t.Run("Flood Retry", func(t *testing.T) {
+		th := &throttler{cfg: ThrottleConfig{Retries: 3}, chats: make(map[int64]*chatSlots)}
+		calls := 0
+		err := th.do(context.Background(), 1, func() error {
+			if calls++; calls < 3 {
+				return fmt.Errorf("telebot: %w", tb.FloodError{})
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+}
@@ -3,130 +3,257 @@ package router
 import "gopkg.in/telebot.v4"
 
 // wrappedBot is a thin wrapper around telebot.API that intercepts all outgoing actions
-// (like sending, editing, replying, etc.) and invokes the markHandled callback before
+// (like sending, editing, replying, etc.) and marks the update state as handled before
 // performing the actual action. This is used internally by the router to track whether
 // a context has already been handled, preventing fallback to the NotFound handler.
+// Methods sending or editing messages also wait for the throttler, if any.
 type wrappedBot struct {
 	telebot.API
-	markHandled func()
+	ctx      telebot.Context
+	state    *state
+	throttle *throttler
 }
 
-func (b *wrappedBot) Send(to telebot.Recipient, what interface{}, opts ...interface{}) (*telebot.Message, error) {
-	b.markHandled()
-	return b.API.Send(to, what, opts...)
+// throttled calls fn, which sends a request to chat, through the throttler if
+// WithThrottle is used.
+func (b *wrappedBot) throttled(chat int64, fn func() error) error {
+	if b.throttle == nil {
+		return fn()
+	}
+	return b.throttle.do(b.state.goContext(), chat, fn)
 }
 
-func (b *wrappedBot) SendAlbum(to telebot.Recipient, a telebot.Album, opts ...interface{}) ([]telebot.Message, error) {
-	b.markHandled()
-	return b.API.SendAlbum(to, a, opts...)
+func (b *wrappedBot) Send(to telebot.Recipient, what interface{}, opts ...interface{}) (result *telebot.Message, err error) {
+	b.state.mark("Send")
+	out := &Outgoing{Method: "Send", To: to, What: what, Opts: opts}
+	err = b.state.respond(b.ctx, out, func(out *Outgoing) error {
+		return b.throttled(recipientID(to), func() (err error) {
+			result, err = b.API.Send(to, out.What, out.Opts...)
+			return err
+		})
+	})
+	return result, err
 }
 
-func (b *wrappedBot) SendPaid(to telebot.Recipient, stars int, a telebot.PaidAlbum, opts ...interface{}) (*telebot.Message, error) {
-	b.markHandled()
-	return b.API.SendPaid(to, stars, a, opts...)
+func (b *wrappedBot) SendAlbum(to telebot.Recipient, a telebot.Album, opts ...interface{}) (result []telebot.Message, err error) {
+	b.state.mark("SendAlbum")
+	out := &Outgoing{Method: "SendAlbum", To: to, What: a, Opts: opts}
+	err = b.state.respond(b.ctx, out, func(out *Outgoing) error {
+		return b.throttled(recipientID(to), func() (err error) {
+			album, _ := out.What.(telebot.Album)
+			result, err = b.API.SendAlbum(to, album, out.Opts...)
+			return err
+		})
+	})
+	return result, err
 }
 
-func (b *wrappedBot) Reply(to *telebot.Message, what interface{}, opts ...interface{}) (*telebot.Message, error) {
-	b.markHandled()
-	return b.API.Reply(to, what, opts...)
+func (b *wrappedBot) SendPaid(to telebot.Recipient, stars int, a telebot.PaidAlbum, opts ...interface{}) (result *telebot.Message, err error) {
+	b.state.mark("SendPaid")
+	err = b.throttled(recipientID(to), func() (err error) {
+		result, err = b.API.SendPaid(to, stars, a, opts...)
+		return err
+	})
+	return result, err
 }
 
-func (b *wrappedBot) Edit(msg telebot.Editable, what interface{}, opts ...interface{}) (*telebot.Message, error) {
-	b.markHandled()
-	return b.API.Edit(msg, what, opts...)
+func (b *wrappedBot) Reply(to *telebot.Message, what interface{}, opts ...interface{}) (result *telebot.Message, err error) {
+	b.state.mark("Reply")
+	out := &Outgoing{Method: "Reply", To: to.Chat, Message: to, What: what, Opts: opts}
+	err = b.state.respond(b.ctx, out, func(out *Outgoing) error {
+		return b.throttled(to.Chat.ID, func() (err error) {
+			result, err = b.API.Reply(to, out.What, out.Opts...)
+			return err
+		})
+	})
+	return result, err
 }
 
-func (b *wrappedBot) EditCaption(msg telebot.Editable, caption string, opts ...interface{}) (*telebot.Message, error) {
-	b.markHandled()
-	return b.API.EditCaption(msg, caption, opts...)
+func (b *wrappedBot) Edit(msg telebot.Editable, what interface{}, opts ...interface{}) (result *telebot.Message, err error) {
+	b.state.mark("Edit")
+	out := &Outgoing{Method: "Edit", Message: msg, What: what, Opts: opts}
+	err = b.state.respond(b.ctx, out, func(out *Outgoing) error {
+		return b.throttled(editableChat(msg), func() (err error) {
+			result, err = b.API.Edit(msg, out.What, out.Opts...)
+			return err
+		})
+	})
+	return result, err
 }
 
-func (b *wrappedBot) EditMedia(msg telebot.Editable, media telebot.Inputtable, opts ...interface{}) (*telebot.Message, error) {
-	b.markHandled()
-	return b.API.EditMedia(msg, media, opts...)
+func (b *wrappedBot) EditCaption(msg telebot.Editable, caption string, opts ...interface{}) (result *telebot.Message, err error) {
+	b.state.mark("EditCaption")
+	out := &Outgoing{Method: "EditCaption", Message: msg, What: caption, Opts: opts}
+	err = b.state.respond(b.ctx, out, func(out *Outgoing) error {
+		return b.throttled(editableChat(msg), func() (err error) {
+			caption, _ := out.What.(string)
+			result, err = b.API.EditCaption(msg, caption, out.Opts...)
+			return err
+		})
+	})
+	return result, err
 }
 
-func (b *wrappedBot) EditReplyMarkup(msg telebot.Editable, markup *telebot.ReplyMarkup) (*telebot.Message, error) {
-	b.markHandled()
-	return b.API.EditReplyMarkup(msg, markup)
+func (b *wrappedBot) EditMedia(msg telebot.Editable, media telebot.Inputtable, opts ...interface{}) (result *telebot.Message, err error) {
+	b.state.mark("EditMedia")
+	err = b.throttled(editableChat(msg), func() (err error) {
+		result, err = b.API.EditMedia(msg, media, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (b *wrappedBot) EditReplyMarkup(msg telebot.Editable, markup *telebot.ReplyMarkup) (result *telebot.Message, err error) {
+	b.state.mark("EditReplyMarkup")
+	err = b.throttled(editableChat(msg), func() (err error) {
+		result, err = b.API.EditReplyMarkup(msg, markup)
+		return err
+	})
+	return result, err
 }
 
 func (b *wrappedBot) Delete(msg telebot.Editable) error {
-	b.markHandled()
+	b.state.mark("Delete")
 	return b.API.Delete(msg)
 }
 
 func (b *wrappedBot) Notify(to telebot.Recipient, action telebot.ChatAction, threadID ...int) error {
-	b.markHandled()
+	b.state.mark("Notify")
 	return b.API.Notify(to, action, threadID...)
 }
 
 func (b *wrappedBot) Respond(c *telebot.Callback, resp ...*telebot.CallbackResponse) error {
-	b.markHandled()
+	b.state.mark("Respond")
 	return b.API.Respond(c, resp...)
 }
 
 func (b *wrappedBot) Answer(q *telebot.Query, r *telebot.QueryResponse) error {
-	b.markHandled()
+	b.state.mark("Answer")
 	return b.API.Answer(q, r)
 }
 
 func (b *wrappedBot) Ship(q *telebot.ShippingQuery, what ...interface{}) error {
-	b.markHandled()
+	b.state.mark("Ship")
 	return b.API.Ship(q, what...)
 }
 
 func (b *wrappedBot) Accept(q *telebot.PreCheckoutQuery, errorMessage ...string) error {
-	b.markHandled()
+	b.state.mark("Accept")
 	return b.API.Accept(q, errorMessage...)
 }
 
-func (b *wrappedBot) Forward(to telebot.Recipient, msg telebot.Editable, opts ...interface{}) (*telebot.Message, error) {
-	b.markHandled()
-	return b.API.Forward(to, msg, opts...)
+func (b *wrappedBot) Forward(to telebot.Recipient, msg telebot.Editable, opts ...interface{}) (result *telebot.Message, err error) {
+	b.state.mark("Forward")
+	err = b.throttled(recipientID(to), func() (err error) {
+		result, err = b.API.Forward(to, msg, opts...)
+		return err
+	})
+	return result, err
 }
 
-func (b *wrappedBot) ForwardMany(to telebot.Recipient, msgs []telebot.Editable, opts ...*telebot.SendOptions) ([]telebot.Message, error) {
-	b.markHandled()
-	return b.API.ForwardMany(to, msgs, opts...)
+func (b *wrappedBot) ForwardMany(to telebot.Recipient, msgs []telebot.Editable, opts ...*telebot.SendOptions) (result []telebot.Message, err error) {
+	b.state.mark("ForwardMany")
+	err = b.throttled(recipientID(to), func() (err error) {
+		result, err = b.API.ForwardMany(to, msgs, opts...)
+		return err
+	})
+	return result, err
 }
 
-func (b *wrappedBot) Copy(to telebot.Recipient, msg telebot.Editable, opts ...interface{}) (*telebot.Message, error) {
-	b.markHandled()
-	return b.API.Copy(to, msg, opts...)
+func (b *wrappedBot) Copy(to telebot.Recipient, msg telebot.Editable, opts ...interface{}) (result *telebot.Message, err error) {
+	b.state.mark("Copy")
+	err = b.throttled(recipientID(to), func() (err error) {
+		result, err = b.API.Copy(to, msg, opts...)
+		return err
+	})
+	return result, err
 }
 
-func (b *wrappedBot) CopyMany(to telebot.Recipient, msgs []telebot.Editable, opts ...*telebot.SendOptions) ([]telebot.Message, error) {
-	b.markHandled()
-	return b.API.CopyMany(to, msgs, opts...)
+func (b *wrappedBot) CopyMany(to telebot.Recipient, msgs []telebot.Editable, opts ...*telebot.SendOptions) (result []telebot.Message, err error) {
+	b.state.mark("CopyMany")
+	err = b.throttled(recipientID(to), func() (err error) {
+		result, err = b.API.CopyMany(to, msgs, opts...)
+		return err
+	})
+	return result, err
 }
 
 func (b *wrappedBot) React(to telebot.Recipient, msg telebot.Editable, r telebot.Reactions) error {
-	b.markHandled()
+	b.state.mark("React")
 	return b.API.React(to, msg, r)
 }
 
 func (b *wrappedBot) Pin(msg telebot.Editable, opts ...interface{}) error {
-	b.markHandled()
+	b.state.mark("Pin")
 	return b.API.Pin(msg, opts...)
 }
 
 func (b *wrappedBot) Unpin(chat telebot.Recipient, messageID ...int) error {
-	b.markHandled()
+	b.state.mark("Unpin")
 	return b.API.Unpin(chat, messageID...)
 }
 
 func (b *wrappedBot) UnpinAll(chat telebot.Recipient) error {
-	b.markHandled()
+	b.state.mark("UnpinAll")
 	return b.API.UnpinAll(chat)
 }
 
 func (b *wrappedBot) StopPoll(msg telebot.Editable, opts ...interface{}) (*telebot.Poll, error) {
-	b.markHandled()
+	b.state.mark("StopPoll")
 	return b.API.StopPoll(msg, opts...)
 }
 
 func (b *wrappedBot) StopLiveLocation(msg telebot.Editable, opts ...interface{}) (*telebot.Message, error) {
-	b.markHandled()
+	b.state.mark("StopLiveLocation")
 	return b.API.StopLiveLocation(msg, opts...)
 }
+
+func (b *wrappedBot) Raw(method string, payload interface{}) ([]byte, error) {
+	b.state.mark("Raw")
+	return b.API.Raw(method, payload)
+}
+
+func (b *wrappedBot) DeleteMany(msgs []telebot.Editable) error {
+	b.state.mark("DeleteMany")
+	return b.API.DeleteMany(msgs)
+}
+
+func (b *wrappedBot) Ban(chat *telebot.Chat, member *telebot.ChatMember, revokeMessages ...bool) error {
+	b.state.mark("Ban")
+	return b.API.Ban(chat, member, revokeMessages...)
+}
+
+func (b *wrappedBot) Unban(chat *telebot.Chat, user *telebot.User, forBanned ...bool) error {
+	b.state.mark("Unban")
+	return b.API.Unban(chat, user, forBanned...)
+}
+
+func (b *wrappedBot) Restrict(chat *telebot.Chat, member *telebot.ChatMember) error {
+	b.state.mark("Restrict")
+	return b.API.Restrict(chat, member)
+}
+
+func (b *wrappedBot) Promote(chat *telebot.Chat, member *telebot.ChatMember) error {
+	b.state.mark("Promote")
+	return b.API.Promote(chat, member)
+}
+
+func (b *wrappedBot) ApproveJoinRequest(chat telebot.Recipient, user *telebot.User) error {
+	b.state.mark("ApproveJoinRequest")
+	return b.API.ApproveJoinRequest(chat, user)
+}
+
+func (b *wrappedBot) DeclineJoinRequest(chat telebot.Recipient, user *telebot.User) error {
+	b.state.mark("DeclineJoinRequest")
+	return b.API.DeclineJoinRequest(chat, user)
+}
+
+func (b *wrappedBot) SetGameScore(user telebot.Recipient, msg telebot.Editable, score telebot.GameHighScore) (*telebot.Message, error) {
+	b.state.mark("SetGameScore")
+	return b.API.SetGameScore(user, msg, score)
+}
+
+func (b *wrappedBot) AnswerWebApp(query *telebot.Query, r telebot.Result) (*telebot.WebAppMessage, error) {
+	b.state.mark("AnswerWebApp")
+	return b.API.AnswerWebApp(query, r)
+}
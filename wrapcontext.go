@@ -2,6 +2,7 @@ package router
 
 import (
 	"gopkg.in/telebot.v4"
+	"time"
 )
 
 // wrappedContext embeds the original telebot.Context and overrides all methods
@@ -11,21 +12,30 @@ import (
 // the NotFound handler unnecessarily.
 type wrappedContext struct {
 	telebot.Context
-	api     *wrappedBot
-	handled bool
+	api   *wrappedBot
+	state *state
 }
 
-func (w *wrappedContext) markHandled() {
-	w.handled = true
+// Get returns the update state for the router's internal key, so the state can
+// be found through contexts that wrap this one, and delegates otherwise.
+func (w *wrappedContext) Get(key string) interface{} {
+	if key == stateKey {
+		return w.state
+	}
+	return w.Context.Get(key)
 }
 
 func (w *wrappedContext) WasHandled() bool {
-	return w.handled
+	return w.state.wasHandled()
 }
 
 func (w *wrappedContext) Send(what interface{}, opts ...interface{}) error {
-	w.markHandled()
-	return w.Context.Send(what, opts...)
+	w.state.mark("Send")
+	return w.state.respond(w, &Outgoing{Method: "Send", What: what, Opts: opts}, func(out *Outgoing) error {
+		return w.api.throttled(chatID(w.Context), func() error {
+			return w.Context.Send(out.What, out.Opts...)
+		})
+	})
 }
 
 func (w *wrappedContext) Bot() telebot.API {
@@ -33,81 +43,116 @@ func (w *wrappedContext) Bot() telebot.API {
 }
 
 func (w *wrappedContext) SendAlbum(a telebot.Album, opts ...interface{}) error {
-	w.markHandled()
-	return w.Context.SendAlbum(a, opts...)
+	w.state.mark("SendAlbum")
+	return w.state.respond(w, &Outgoing{Method: "SendAlbum", What: a, Opts: opts}, func(out *Outgoing) error {
+		return w.api.throttled(chatID(w.Context), func() error {
+			album, _ := out.What.(telebot.Album)
+			return w.Context.SendAlbum(album, out.Opts...)
+		})
+	})
 }
 
 func (w *wrappedContext) Reply(what interface{}, opts ...interface{}) error {
-	w.markHandled()
-	return w.Context.Reply(what, opts...)
+	w.state.mark("Reply")
+	return w.state.respond(w, &Outgoing{Method: "Reply", What: what, Opts: opts}, func(out *Outgoing) error {
+		return w.api.throttled(chatID(w.Context), func() error {
+			return w.Context.Reply(out.What, out.Opts...)
+		})
+	})
 }
 
 func (w *wrappedContext) Forward(msg telebot.Editable, opts ...interface{}) error {
-	w.markHandled()
-	return w.Context.Forward(msg, opts...)
+	w.state.mark("Forward")
+	return w.api.throttled(chatID(w.Context), func() error {
+		return w.Context.Forward(msg, opts...)
+	})
 }
 
 func (w *wrappedContext) ForwardTo(to telebot.Recipient, opts ...interface{}) error {
-	w.markHandled()
-	return w.Context.ForwardTo(to, opts...)
+	w.state.mark("ForwardTo")
+	return w.api.throttled(recipientID(to), func() error {
+		return w.Context.ForwardTo(to, opts...)
+	})
 }
 
 func (w *wrappedContext) Edit(what interface{}, opts ...interface{}) error {
-	w.markHandled()
-	return w.Context.Edit(what, opts...)
+	w.state.mark("Edit")
+	return w.state.respond(w, &Outgoing{Method: "Edit", What: what, Opts: opts}, func(out *Outgoing) error {
+		return w.api.throttled(chatID(w.Context), func() error {
+			return w.Context.Edit(out.What, out.Opts...)
+		})
+	})
 }
 
 func (w *wrappedContext) EditCaption(caption string, opts ...interface{}) error {
-	w.markHandled()
-	return w.Context.EditCaption(caption, opts...)
+	w.state.mark("EditCaption")
+	return w.state.respond(w, &Outgoing{Method: "EditCaption", What: caption, Opts: opts}, func(out *Outgoing) error {
+		return w.api.throttled(chatID(w.Context), func() error {
+			caption, _ := out.What.(string)
+			return w.Context.EditCaption(caption, out.Opts...)
+		})
+	})
 }
 
 func (w *wrappedContext) EditOrSend(what interface{}, opts ...interface{}) error {
-	w.markHandled()
-	return w.Context.EditOrSend(what, opts...)
+	w.state.mark("EditOrSend")
+	return w.state.respond(w, &Outgoing{Method: "EditOrSend", What: what, Opts: opts}, func(out *Outgoing) error {
+		return w.api.throttled(chatID(w.Context), func() error {
+			return w.Context.EditOrSend(out.What, out.Opts...)
+		})
+	})
 }
 
 func (w *wrappedContext) EditOrReply(what interface{}, opts ...interface{}) error {
-	w.markHandled()
-	return w.Context.EditOrReply(what, opts...)
+	w.state.mark("EditOrReply")
+	return w.state.respond(w, &Outgoing{Method: "EditOrReply", What: what, Opts: opts}, func(out *Outgoing) error {
+		return w.api.throttled(chatID(w.Context), func() error {
+			return w.Context.EditOrReply(out.What, out.Opts...)
+		})
+	})
 }
 
 func (w *wrappedContext) Delete() error {
-	w.markHandled()
+	w.state.mark("Delete")
 	return w.Context.Delete()
 }
 
 func (w *wrappedContext) Respond(resp ...*telebot.CallbackResponse) error {
-	w.markHandled()
+	w.state.mark("Respond")
 	return w.Context.Respond(resp...)
 }
 
 func (w *wrappedContext) RespondText(text string) error {
-	w.markHandled()
+	w.state.mark("RespondText")
 	return w.Context.RespondText(text)
 }
 
 func (w *wrappedContext) RespondAlert(text string) error {
-	w.markHandled()
+	w.state.mark("RespondAlert")
 	return w.Context.RespondAlert(text)
 }
 
 func (w *wrappedContext) Answer(resp *telebot.QueryResponse) error {
-	w.markHandled()
+	w.state.mark("Answer")
 	return w.Context.Answer(resp)
 }
 
 func (w *wrappedContext) Accept(errorMessage ...string) error {
-	w.markHandled()
+	w.state.mark("Accept")
 	return w.Context.Accept(errorMessage...)
 }
 
 func (w *wrappedContext) Ship(what ...interface{}) error {
-	w.markHandled()
+	w.state.mark("Ship")
 	return w.Context.Ship(what...)
 }
 
+func (w *wrappedContext) DeleteAfter(d time.Duration) *time.Timer {
+	w.state.mark("DeleteAfter")
+	return w.Context.DeleteAfter(d)
+}
+
 func (w *wrappedContext) Notify(action telebot.ChatAction) error {
-	w.markHandled()
+	w.state.mark("Notify")
 	return w.Context.Notify(action)
 }